@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// statusRecorder wraps a ResponseWriter to capture the status code and
+// number of body bytes written, which handlers like http.FileServer
+// otherwise keep to themselves.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	// a 100 Continue or other interim response isn't the one to record
+	if sr.status == 0 && !interimStatus(status) {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.size += int64(n)
+	return n, err
+}
+
+// ReadFrom lets the underlying writer's ReadFrom, and so sendfile, send
+// bodies copied from files.
+func (sr *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := sr.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(sr.ResponseWriter, src)
+	}
+	sr.size += n
+	return n, err
+}
+
+// Flush lets streaming responses through the recorder.
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over for protocol upgrades such as
+// WebSockets, which are logged as 101 Switching Protocols.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && sr.status == 0 {
+		sr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// logFormats are the accepted values of -log-format.
+var logFormats = map[string]bool{"": true, "text": true, "json": true}
+
+// accessLogEntry is a request as logged in the json format.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Size       int64     `json:"size"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// accessLog logs a line per request in the given format, text or json.
+// If errorsOnly is set, only requests that end in a 4xx or 5xx response
+// are logged.
+func accessLog(format string, errorsOnly bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		if errorsOnly && sr.status < 400 {
+			return
+		}
+		elapsed := time.Since(start)
+		if format == "json" {
+			line, err := json.Marshal(accessLogEntry{
+				Time:       start,
+				Remote:     r.RemoteAddr,
+				Method:     r.Method,
+				Path:       r.URL.RequestURI(),
+				Status:     sr.status,
+				Size:       sr.size,
+				DurationMS: float64(elapsed) / float64(time.Millisecond),
+			})
+			if err != nil {
+				log.Println("access log:", err)
+				return
+			}
+			// bypass the log prefix so each line is a JSON document
+			fmt.Fprintln(log.Writer(), string(line))
+			return
+		}
+		log.Printf("%s %s %s %d %d %s\n",
+			r.RemoteAddr, r.Method, r.URL.RequestURI(), sr.status, sr.size, elapsed)
+	})
+}
+
+// trafficTotals counts the requests handled and body bytes served over
+// the life of the process.
+type trafficTotals struct {
+	requests *shardedCounter
+	bytes    *shardedCounter
+}
+
+func newTrafficTotals() *trafficTotals {
+	return &trafficTotals{requests: newShardedCounter(), bytes: newShardedCounter()}
+}
+
+// count adds every request through next to the totals.
+func (t *trafficTotals) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		key := shardKey()
+		t.requests.add(key, 1)
+		t.bytes.add(key, sr.size)
+	})
+}
+
+func (t *trafficTotals) String() string {
+	return fmt.Sprintf("%d requests, %d bytes served", t.requests.load(), t.bytes.load())
+}
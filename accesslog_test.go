@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog sends the log to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	buf := captureLog(t)
+	h := accessLog("json", false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/pot?x=1", nil))
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line %q: %v", buf.String(), err)
+	}
+	if entry.Status != http.StatusTeapot || entry.Size != 15 || entry.Path != "/pot?x=1" {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+func TestAccessLogErrorsOnly(t *testing.T) {
+	buf := captureLog(t)
+	h := accessLog("text", true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "/missing 404") {
+		t.Errorf("logged %q, want only the 404", lines)
+	}
+}
+
+func TestStatusRecorderSkipsInterimResponses(t *testing.T) {
+	buf := captureLog(t)
+	h := accessLog("json", false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusContinue)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	w := &interimRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/upload", nil))
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line %q: %v", buf.String(), err)
+	}
+	if entry.Status != http.StatusCreated {
+		t.Errorf("logged status %d, want 201", entry.Status)
+	}
+	if len(w.interim) != 1 || w.Code != http.StatusCreated {
+		t.Errorf("client got %v then %d, want [100] then 201", w.interim, w.Code)
+	}
+}
+
+func TestStatusRecorderKeepsSendfile(t *testing.T) {
+	captureLog(t)
+	root := writeTree(t, "index.html", "app.js")
+	h := accessLog("text", false, spaHandler{staticPath: root, indexPath: "index.html"})
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if w.Body.String() != "app.js" {
+		t.Fatalf("got %q", w.Body.String())
+	}
+	if _, ok := w.src.(*os.File); !ok {
+		t.Errorf("body copied from %T, want *os.File so sendfile can be used", w.src)
+	}
+}
+
+func TestStatusRecorderHijack(t *testing.T) {
+	buf := captureLog(t)
+	done := make(chan struct{})
+	logged := accessLog("text", false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logged.ServeHTTP(w, r)
+		close(done)
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /socket HTTP/1.1\r\nHost: x\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	<-done
+	if !strings.Contains(buf.String(), "/socket 101") {
+		t.Errorf("logged %q, want a 101", buf.String())
+	}
+}
+
+func TestStatusRecorderHijackUnsupported(t *testing.T) {
+	w := httptest.NewRecorder()
+	sr := &statusRecorder{ResponseWriter: w}
+	if _, _, err := sr.Hijack(); err != http.ErrNotSupported {
+		t.Errorf("err = %v, want ErrNotSupported", err)
+	}
+	if sr.Unwrap() != w {
+		t.Error("Unwrap did not return the underlying writer")
+	}
+}
+
+func TestTrafficTotals(t *testing.T) {
+	totals := newTrafficTotals()
+	h := totals.count(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if got, want := totals.String(), "3 requests, 15 bytes served"; got != want {
+		t.Errorf("totals = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// http3Server is an HTTP/3 server running alongside the TCP one.
+type http3Server interface {
+	Shutdown(ctx context.Context) error
+}
+
+// advertiseHTTP3 adds an Alt-Svc header to responses sent over TLS on
+// TCP, telling clients they can switch to HTTP/3 on port.
+func advertiseHTTP3(port int, next http.Handler) http.Handler {
+	value := fmt.Sprintf(`h3=":%d"; ma=86400`, port)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && r.ProtoMajor < 3 {
+			w.Header().Set("Alt-Svc", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
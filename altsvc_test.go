@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdvertiseHTTP3(t *testing.T) {
+	h := advertiseHTTP3(8443, http.NotFoundHandler())
+	tests := []struct {
+		name  string
+		tls   bool
+		major int
+		want  string
+	}{
+		{"plain HTTP", false, 1, ""},
+		{"HTTP/1.1 over TLS", true, 1, `h3=":8443"; ma=86400`},
+		{"HTTP/2", true, 2, `h3=":8443"; ma=86400`},
+		{"HTTP/3", true, 3, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.ProtoMajor = tt.major
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		} else {
+			r.TLS = nil
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Alt-Svc"); got != tt.want {
+			t.Errorf("%s: Alt-Svc = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
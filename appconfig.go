@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// appConfigFlag collects repeated -app-config flags of the form
+// key=value. Values may refer to environment variables as $VAR or
+// ${VAR}.
+type appConfigFlag map[string]string
+
+func (f appConfigFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f appConfigFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// appConfigHandler serves a JSON object synthesized from the -app-config
+// flags, unless a real file exists at the same path in the static dir,
+// in which case that file wins and is served by next.
+type appConfigHandler struct {
+	root func() string
+	body []byte
+	next http.Handler
+}
+
+func newAppConfigHandler(config appConfigFlag, root func() string, next http.Handler) (*appConfigHandler, error) {
+	values := make(map[string]string, len(config))
+	for key, value := range config {
+		values[key] = os.ExpandEnv(value)
+	}
+	body, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return &appConfigHandler{root: root, body: body, next: next}, nil
+}
+
+func (h *appConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, err := os.Stat(filepath.Join(h.root(), filepath.FromSlash(r.URL.Path))); err == nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(h.body))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAppConfigHandler(t *testing.T) {
+	t.Setenv("API_HOST", "api.example.com")
+	config := appConfigFlag{}
+	for _, value := range []string{"apiUrl=https://${API_HOST}/v1", "env=prod=eu"} {
+		if err := config.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := writeTree(t, "index.html")
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("from disk"))
+	})
+	h, err := newAppConfigHandler(config, func() string { return root }, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/config.json", nil))
+	var got map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["apiUrl"] != "https://api.example.com/v1" || got["env"] != "prod=eu" {
+		t.Errorf("config = %v", got)
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+
+	// a real file at the path wins
+	root = writeTree(t, "index.html", "config.json")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/config.json", nil))
+	if w.Body.String() != "from disk" {
+		t.Errorf("with a file on disk got %q", w.Body.String())
+	}
+}
+
+func TestAppConfigFlagSet(t *testing.T) {
+	for _, bad := range []string{"novalue", "=value"} {
+		if err := (appConfigFlag{}).Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fontTypes maps web font extensions to their media types. Fonts are
+// never modified once published and are already compressed, so they are
+// cached for a year and are not worth compressing again.
+var fontTypes = map[string]string{
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+func init() {
+	// not every system's mime database knows about web fonts
+	for ext, typ := range fontTypes {
+		mime.AddExtensionType(ext, typ)
+	}
+}
+
+// isFont reports whether the file at the given path is a web font.
+func isFont(path string) bool {
+	_, ok := fontTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// setFontHeaders marks a font response as immutable. Browsers load
+// @font-face fonts with CORS, which is left to the cors handler so that
+// -cors-origins applies to fonts too.
+func setFontHeaders(h http.Header) {
+	h.Set("Cache-Control", "public, max-age=31536000, immutable")
+}
+
+// isAsset reports whether the path names an asset (a file with an
+// extension other than HTML) rather than a page of the app.
+func isAsset(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case "", ".html", ".htm":
+		return false
+	}
+	return true
+}
+
+// setIsolationHeaders makes the response cross-origin isolated: pages
+// get COOP and COEP, and assets get CORP so isolated pages may load them.
+func setIsolationHeaders(h http.Header, path string) {
+	if isAsset(path) {
+		h.Set("Cross-Origin-Resource-Policy", "same-origin")
+		return
+	}
+	h.Set("Cross-Origin-Opener-Policy", "same-origin")
+	h.Set("Cross-Origin-Embedder-Policy", "require-corp")
+}
+
+// setDeclaredType sets Content-Type from the file's extension so the
+// response never depends on content sniffing, using a generic binary
+// type for extensions we don't know.
+func setDeclaredType(h http.Header, path string) {
+	typ := mime.TypeByExtension(filepath.Ext(path))
+	if typ == "" {
+		typ = "application/octet-stream"
+	}
+	h.Set("Content-Type", typ)
+}
+
+// defaultAssetPattern matches file names carrying a content hash, such
+// as app.3f2a9c1d.js, which bundlers emit for long-term caching.
+const defaultAssetPattern = `\.[0-9a-f]{8,}\.`
+
+// setImmutableHeaders lets clients cache a fingerprinted asset for
+// maxAge without revalidating, since its name changes with its content.
+func setImmutableHeaders(h http.Header, maxAge time.Duration) {
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int64(maxAge/time.Second)))
+}
+
+// setNoCacheHeaders makes clients revalidate the index on every load so
+// a new build is picked up as soon as it is deployed.
+func setNoCacheHeaders(h http.Header) {
+	h.Set("Cache-Control", "no-cache")
+}
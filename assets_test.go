@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/rs/cors"
+)
+
+func TestFontHeaders(t *testing.T) {
+	root := writeTree(t, "index.html", "fonts/inter.woff2")
+	spa := spaHandler{staticPath: root, indexPath: "index.html"}
+	h := cors.New(cors.Options{AllowedOrigins: []string{"https://app.example.com"}}).Handler(spa)
+	tests := []struct {
+		origin, want string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.example.net", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/fonts/inter.woff2", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.want)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+			t.Errorf("origin %q: Cache-Control = %q", tt.origin, got)
+		}
+	}
+}
+
+func TestIsAsset(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/app.js":     true,
+		"/logo.PNG":   true,
+		"/about":      false,
+		"/index.html": false,
+		"/page.HTM":   false,
+	} {
+		if got := isAsset(path); got != want {
+			t.Errorf("isAsset(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestNosniff(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js", "data.unknownext", "README")
+	h := spaHandler{staticPath: root, indexPath: "index.html", nosniff: true}
+	for path, want := range map[string]string{
+		"/app.js":          "text/javascript; charset=utf-8",
+		"/data.unknownext": "application/octet-stream",
+		"/README":          "application/octet-stream",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if got := w.Header().Get("Content-Type"); got != want {
+			t.Errorf("%s: Content-Type = %q, want %q", path, got, want)
+		}
+		if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options = %q, want nosniff", path, got)
+		}
+	}
+}
+
+func TestDevMode(t *testing.T) {
+	root := writeTree(t, "index.html")
+	h := spaHandler{staticPath: root, indexPath: "index.html", dev: true}
+	captureLog(t)
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/static/missing.js", http.StatusNotFound},
+		{"/some/route", http.StatusOK},
+		{"/page.html", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+func TestIsolationHeaders(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js")
+	h := spaHandler{staticPath: root, indexPath: "index.html", isolate: true}
+	tests := []struct {
+		path, header, want string
+	}{
+		{"/some/route", "Cross-Origin-Opener-Policy", "same-origin"},
+		{"/some/route", "Cross-Origin-Embedder-Policy", "require-corp"},
+		{"/", "Cross-Origin-Embedder-Policy", "require-corp"},
+		{"/app.js", "Cross-Origin-Resource-Policy", "same-origin"},
+		{"/app.js", "Cross-Origin-Embedder-Policy", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if got := w.Header().Get(tt.header); got != tt.want {
+			t.Errorf("%s: %s = %q, want %q", tt.path, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestImmutableAssets(t *testing.T) {
+	root := writeTree(t, "index.html", "app.3f2a9c1d.js", "logo.png", "docs/index.html")
+	h := spaHandler{
+		staticPath:   root,
+		indexPath:    "index.html",
+		assetPattern: regexp.MustCompile(defaultAssetPattern),
+		staticMaxAge: time.Hour,
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"/app.3f2a9c1d.js", "public, max-age=3600, immutable"},
+		{"/logo.png", ""},
+		{"/", "no-cache"},
+		{"/docs/", "no-cache"},
+		{"/some/route", "no-cache"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: Cache-Control = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upstream is one backend a proxy can send requests to.
+type upstream struct {
+	target *url.URL
+	// direct rewrites an outgoing request to point at target
+	direct func(*http.Request)
+}
+
+// balancer spreads requests over a set of upstreams, either in turn or
+// at random. Upstreams that fail to connect are skipped for a cooldown
+// period (passive health checking).
+type balancer struct {
+	upstreams []*upstream
+	random    bool
+	cooldown  time.Duration
+	// now is the clock used for cooldowns, swappable for testing
+	now func() time.Time
+
+	next uint32
+
+	mu        sync.Mutex
+	downUntil map[*upstream]time.Time
+}
+
+func newBalancer(targets []*url.URL, random bool, cooldown time.Duration) *balancer {
+	b := &balancer{
+		random:    random,
+		cooldown:  cooldown,
+		now:       time.Now,
+		downUntil: make(map[*upstream]time.Time),
+	}
+	for _, target := range targets {
+		b.upstreams = append(b.upstreams, &upstream{
+			target: target,
+			direct: httputil.NewSingleHostReverseProxy(target).Director,
+		})
+	}
+	return b
+}
+
+// pick chooses the upstream for a request, preferring healthy ones. If
+// every upstream is cooling down, one is returned anyway.
+func (b *balancer) pick() *upstream {
+	n := len(b.upstreams)
+	start := int(atomic.AddUint32(&b.next, 1)-1) % n
+	if b.random {
+		start = rand.Intn(n)
+	}
+
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < n; i++ {
+		u := b.upstreams[(start+i)%n]
+		if now.After(b.downUntil[u]) {
+			return u
+		}
+	}
+	return b.upstreams[start]
+}
+
+// markDown takes the upstream serving the given host out of rotation
+// for the cooldown period.
+func (b *balancer) markDown(host string) {
+	for _, u := range b.upstreams {
+		if u.target.Host == host {
+			b.mu.Lock()
+			b.downUntil[u] = b.now().Add(b.cooldown)
+			b.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testUpstreams(t *testing.T, hosts ...string) []*url.URL {
+	t.Helper()
+	var targets []*url.URL
+	for _, host := range hosts {
+		targets = append(targets, &url.URL{Scheme: "http", Host: host})
+	}
+	return targets
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b := newBalancer(testUpstreams(t, "a:80", "b:80", "c:80"), false, time.Second)
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, b.pick().target.Host)
+	}
+	want := []string{"a:80", "b:80", "c:80", "a:80", "b:80", "c:80"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("picked %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBalancerCooldown(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBalancer(testUpstreams(t, "a:80", "b:80"), false, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	b.markDown("a:80")
+	for i := 0; i < 4; i++ {
+		if host := b.pick().target.Host; host != "b:80" {
+			t.Fatalf("picked %s during a's cooldown", host)
+		}
+	}
+
+	// with every upstream down, one is still returned
+	b.markDown("b:80")
+	if b.pick() == nil {
+		t.Fatal("no upstream picked while all are down")
+	}
+
+	now = now.Add(11 * time.Second)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[b.pick().target.Host] = true
+	}
+	if !seen["a:80"] || !seen["b:80"] {
+		t.Errorf("after the cooldown picked %v, want both", seen)
+	}
+}
+
+func TestBalancerRandom(t *testing.T) {
+	b := newBalancer(testUpstreams(t, "a:80", "b:80"), true, time.Second)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		seen[b.pick().target.Host] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("random picks only reached %v", seen)
+	}
+}
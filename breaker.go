@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// circuit breaker states
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops sending requests to a failing backend. Once
+// threshold failures happen within window the circuit opens and
+// requests fail fast; after cooldown a single probe request is let
+// through (half-open), and its outcome closes or re-opens the circuit.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	// now is the clock used for the window and cooldown, swappable for
+	// testing
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    int
+	failures []time.Time
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a request may go through to the backend.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = breakerHalfOpen
+		cb.probing = true
+		return true
+	case breakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+	return true
+}
+
+// done records the outcome of a request that allow let through.
+func (cb *circuitBreaker) done(failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := cb.now()
+
+	if cb.state == breakerHalfOpen {
+		cb.probing = false
+		if failed {
+			cb.state = breakerOpen
+			cb.openedAt = now
+		} else {
+			cb.state = breakerClosed
+			cb.failures = nil
+		}
+		return
+	}
+	if !failed {
+		return
+	}
+
+	// forget failures that fell out of the window
+	recent := cb.failures[:0]
+	for _, t := range cb.failures {
+		if now.Sub(t) < cb.window {
+			recent = append(recent, t)
+		}
+	}
+	cb.failures = append(recent, now)
+	if len(cb.failures) >= cb.threshold {
+		cb.state = breakerOpen
+		cb.openedAt = now
+		cb.failures = nil
+	}
+}
+
+// wrap fails requests fast with a 503 while the circuit is open. Any
+// 5xx response from next counts as a failure.
+func (cb *circuitBreaker) wrap(retryAfter time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cb.allow() {
+			serviceUnavailable(w, retryAfter)
+			return
+		}
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		cb.done(sr.status >= 500)
+	})
+}
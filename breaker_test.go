@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(2, time.Minute, 10*time.Second)
+	cb.now = func() time.Time { return now }
+
+	// failures outside the window don't add up
+	cb.done(true)
+	now = now.Add(2 * time.Minute)
+	cb.done(true)
+	if !cb.allow() {
+		t.Fatal("opened on failures spread beyond the window")
+	}
+
+	cb.done(true)
+	if cb.allow() {
+		t.Fatal("still closed after threshold failures")
+	}
+
+	// after the cooldown a single probe goes through
+	now = now.Add(10 * time.Second)
+	if !cb.allow() {
+		t.Fatal("no probe allowed after the cooldown")
+	}
+	if cb.allow() {
+		t.Error("a second request went through while probing")
+	}
+	cb.done(true)
+	if cb.allow() {
+		t.Error("closed after a failed probe")
+	}
+
+	now = now.Add(10 * time.Second)
+	cb.allow()
+	cb.done(false)
+	if !cb.allow() || !cb.allow() {
+		t.Error("still open after a successful probe")
+	}
+}
+
+func TestCircuitBreakerWrap(t *testing.T) {
+	cb := newCircuitBreaker(1, time.Minute, time.Minute)
+	status := http.StatusBadGateway
+	h := cb.wrap(30*time.Second, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want the backend's 502", w.Code)
+	}
+	status = http.StatusOK
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("got %d with Retry-After %q, want a 503 with 30", w.Code, w.Header().Get("Retry-After"))
+	}
+}
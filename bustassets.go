@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// assetTagPattern matches the opening tags that load assets.
+var assetTagPattern = regexp.MustCompile(`(?i)<(script|link)\b[^>]*>`)
+
+// assetURLPatterns match, per tag, the attribute holding the asset's URL
+// when it is root-relative, but not protocol-relative URLs such as
+// //cdn.example.com/x.js.
+var assetURLPatterns = map[string]*regexp.Regexp{
+	"script": attrURLPattern("src"),
+	"link":   attrURLPattern("href"),
+}
+
+func attrURLPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(\s` + name + `\s*=\s*)(["'])(/[^/"'][^"']*)(["'])`)
+}
+
+// pageLinkPattern matches link tags that name pages rather than assets.
+var pageLinkPattern = regexp.MustCompile(`(?i)\srel\s*=\s*["']?(?:canonical|alternate)\b`)
+
+// bustAssets returns a transform that adds a v=version query parameter to
+// the root-relative URLs of scripts and linked assets, such as
+// stylesheets, in an index, so clients fetch new copies after each
+// deploy. Other URLs, such as those of navigation links, are left alone.
+func bustAssets(version string) indexTransform {
+	param := "v=" + url.QueryEscape(version)
+	return func(src []byte) ([]byte, error) {
+		return assetTagPattern.ReplaceAllFunc(src, func(tag []byte) []byte {
+			name := strings.ToLower(string(assetTagPattern.FindSubmatch(tag)[1]))
+			if name == "link" && pageLinkPattern.Match(tag) {
+				return tag
+			}
+			pattern := assetURLPatterns[name]
+			return pattern.ReplaceAllFunc(tag, func(m []byte) []byte {
+				parts := pattern.FindSubmatch(m)
+				if string(parts[2]) != string(parts[4]) {
+					return m
+				}
+				u := string(parts[3])
+				fragment := ""
+				if i := strings.IndexByte(u, '#'); i >= 0 {
+					u, fragment = u[:i], u[i:]
+				}
+				sep := "?"
+				if strings.Contains(u, "?") {
+					sep = "&"
+				}
+				out := string(parts[1]) + string(parts[2]) + u + sep + param + fragment + string(parts[4])
+				return []byte(out)
+			})
+		}), nil
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestBustAssets(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`<script src="/app.js"></script>`, `<script src="/app.js?v=42"></script>`},
+		{`<script type="module" src='/a.js?x=1#f'></script>`, `<script type="module" src='/a.js?x=1&v=42#f'></script>`},
+		{`<link rel="stylesheet" href="/app.css">`, `<link rel="stylesheet" href="/app.css?v=42">`},
+		{`<LINK REL=icon HREF="/favicon.ico">`, `<LINK REL=icon HREF="/favicon.ico?v=42">`},
+		{`<a href="/about">About</a>`, `<a href="/about">About</a>`},
+		{`<img src="/logo.png">`, `<img src="/logo.png">`},
+		{`<link rel="canonical" href="/">`, `<link rel="canonical" href="/">`},
+		{`<script data-src="/lazy.js"></script>`, `<script data-src="/lazy.js"></script>`},
+		{`<script src="//cdn.example.com/x.js"></script>`, `<script src="//cdn.example.com/x.js"></script>`},
+		{`<script src="https://cdn.example.com/x.js"></script>`, `<script src="https://cdn.example.com/x.js"></script>`},
+	}
+	transform := bustAssets("42")
+	for _, tt := range tests {
+		got, err := transform([]byte(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("bustAssets(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
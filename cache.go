@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// cachedFile is the in-memory copy of a file on disk.
+type cachedFile struct {
+	body    []byte
+	modTime time.Time
+	loaded  time.Time
+}
+
+// fileCache keeps the contents of served files in memory. Entries are
+// re-read from disk once they are older than ttl; a zero ttl means
+// entries never expire.
+type fileCache struct {
+	ttl time.Duration
+	// now is the clock used to age entries, swappable for testing
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cachedFile
+}
+
+func newFileCache(ttl time.Duration) *fileCache {
+	return &fileCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*cachedFile),
+	}
+}
+
+// get returns the cached contents of the file at path, reading it from
+// disk if it isn't cached yet or its entry has expired.
+func (c *fileCache) get(path string) (*cachedFile, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	f, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && (c.ttl <= 0 || now.Sub(f.loaded) < c.ttl) {
+		return f, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f = &cachedFile{
+		body:    body,
+		modTime: info.ModTime(),
+		loaded:  now,
+	}
+
+	c.mu.Lock()
+	c.entries[path] = f
+	c.mu.Unlock()
+	return f, nil
+}
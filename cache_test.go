@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCacheExpires(t *testing.T) {
+	path := filepath.Join(writeTree(t, "app.js"), "app.js")
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newFileCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	get := func() string {
+		t.Helper()
+		f, err := c.get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(f.body)
+	}
+	if got := get(); got != "app.js" {
+		t.Fatalf("got %q", got)
+	}
+	if err := ioutil.WriteFile(path, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(59 * time.Second)
+	if got := get(); got != "app.js" {
+		t.Errorf("within the ttl got %q, want the cached copy", got)
+	}
+	now = now.Add(time.Second)
+	if got := get(); got != "v2" {
+		t.Errorf("after the ttl got %q, want the file re-read", got)
+	}
+}
+
+func TestFileCacheNoTTL(t *testing.T) {
+	path := filepath.Join(writeTree(t, "app.js"), "app.js")
+	now := time.Now()
+	c := newFileCache(0)
+	c.now = func() time.Time { return now }
+	if _, err := c.get(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(24 * time.Hour)
+	if f, _ := c.get(path); string(f.body) != "app.js" {
+		t.Errorf("got %q, want entries kept without a ttl", f.body)
+	}
+}
+
+func TestFileCacheMissing(t *testing.T) {
+	c := newFileCache(0)
+	if _, err := c.get(filepath.Join(t.TempDir(), "missing.js")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+)
+
+// certNames returns the names the certificate should be valid for: the
+// domain if there is one, otherwise the host, unless the host is a
+// wildcard address that clients can't connect to by name.
+func certNames(domain, host string) []string {
+	if domain != "" {
+		return []string{domain}
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return nil
+	}
+	return []string{host}
+}
+
+// checkCertNames reports an error if the leaf certificate in certFile
+// isn't valid for every one of names, going by its SANs.
+func checkCertNames(certFile, keyFile string, names []string) error {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := leaf.VerifyHostname(name); err != nil {
+			return fmt.Errorf("%s: %v", certFile, err)
+		}
+	}
+	return nil
+}
+
+// validateCert checks -tls-cert against the names clients will use at
+// startup, so a mismatched certificate is caught before it is served. A
+// mismatch is logged as a warning, or returned if strict is set.
+func validateCert(certFile, keyFile string, names []string, strict bool) error {
+	err := checkCertNames(certFile, keyFile, names)
+	if err == nil || strict {
+		return err
+	}
+	log.Println("Warning: certificate doesn't match:", err)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for the given DNS names and
+// IPs and its key, returning their paths.
+func writeCert(t *testing.T, names []string, ips []net.IP) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     names,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCheckCertNames(t *testing.T) {
+	certFile, keyFile := writeCert(t, []string{"example.com", "*.example.com"}, []net.IP{net.ParseIP("10.0.0.7")})
+	tests := []struct {
+		names []string
+		ok    bool
+	}{
+		{nil, true},
+		{[]string{"example.com"}, true},
+		{[]string{"www.example.com"}, true},
+		{[]string{"10.0.0.7"}, true},
+		{[]string{"example.org"}, false},
+		{[]string{"a.b.example.com"}, false},
+		{[]string{"example.com", "10.0.0.8"}, false},
+	}
+	for _, tt := range tests {
+		err := checkCertNames(certFile, keyFile, tt.names)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkCertNames(%v) = %v, want ok %v", tt.names, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateCertMismatch(t *testing.T) {
+	certFile, keyFile := writeCert(t, []string{"example.com"}, nil)
+	names := []string{"example.org"}
+
+	buf := captureLog(t)
+	if err := validateCert(certFile, keyFile, names, false); err != nil {
+		t.Errorf("lenient: err = %v, want a warning only", err)
+	}
+	if !strings.Contains(buf.String(), "Warning: certificate doesn't match") {
+		t.Errorf("lenient: logged %q, want a warning", buf.String())
+	}
+
+	buf.Reset()
+	err := validateCert(certFile, keyFile, names, true)
+	if err == nil || !strings.Contains(err.Error(), "example.org") {
+		t.Errorf("strict: err = %v, want a mismatch naming example.org", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("strict: logged %q, want nothing", buf.String())
+	}
+}
+
+func TestCertNames(t *testing.T) {
+	tests := []struct {
+		domain, host string
+		want         string
+	}{
+		{"example.com", "0.0.0.0", "example.com"},
+		{"", "0.0.0.0", ""},
+		{"", "::", ""},
+		{"", "app.internal", "app.internal"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(certNames(tt.domain, tt.host), ","); got != tt.want {
+			t.Errorf("certNames(%q, %q) = %q, want %q", tt.domain, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(ioutil.Discard)
+	},
+}
+
+// gzipResponseWriter compresses a response on the fly once it knows the
+// response is worth compressing: a compressible type, not already
+// encoded, and at least minBytes long. Until then it holds the status
+// and the start of the body back.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minBytes int
+	// head marks a HEAD request, which has no body to judge the size by
+	head bool
+	// bufferHTML compresses HTML responses into held and sends them
+	// whole, with a Content-Length, once the handler is done
+	bufferHTML bool
+	held       *bytes.Buffer
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if interimStatus(status) {
+		// sent ahead of the response, which is still to come
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minBytes {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	} else if !w.eligible() {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// ReadFrom hands bodies that won't be compressed to the underlying
+// writer's ReadFrom, so files can still be sent with sendfile.
+func (w *gzipResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided && !w.eligible() {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok && w.decided && w.gz == nil {
+		return rf.ReadFrom(src)
+	}
+	// hide ReadFrom from io.Copy, which would call it again
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+// eligible reports whether the response could be compressed, going by
+// what is known about it so far.
+func (w *gzipResponseWriter) eligible() bool {
+	h := w.Header()
+	switch w.status {
+	case http.StatusPartialContent, http.StatusNoContent, http.StatusNotModified:
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if typ := h.Get("Content-Type"); typ != "" && !isCompressibleType(typ) {
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < w.minBytes {
+			return false
+		}
+	}
+	return true
+}
+
+// knownLength reports whether the handler declared a Content-Length, which
+// eligible has already checked against minBytes.
+func (w *gzipResponseWriter) knownLength() bool {
+	return w.Header().Get("Content-Length") != ""
+}
+
+// decide settles whether to compress, based on the headers and what has
+// been buffered, then sends the headers and buffered body on.
+func (w *gzipResponseWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// as net/http would, but we need to know the type now
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if w.eligible() && (len(w.buf) >= w.minBytes || w.head && w.knownLength()) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		h.Add("Vary", "Accept-Encoding")
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, "\"") {
+			// the compressed bytes differ from those the tag names
+			h.Set("ETag", "W/"+etag)
+		}
+		if !w.head {
+			w.gz = gzipWriters.Get().(*gzip.Writer)
+			if w.bufferHTML && isHTML(h.Get("Content-Type")) {
+				w.held = new(bytes.Buffer)
+				w.gz.Reset(w.held)
+			} else {
+				w.gz.Reset(w.ResponseWriter)
+			}
+		}
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.held == nil {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends whatever has been written so far, compressed or not. A
+// response being held back to learn its length can't be flushed.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.held != nil {
+		return
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the response once the handler has returned.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// the handler wrote nothing at all; leave it to net/http
+			return
+		}
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+	if w.held != nil {
+		w.Header().Set("Content-Length", strconv.Itoa(w.held.Len()))
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.held.Bytes())
+		w.held = nil
+	}
+}
+
+// interimStatus reports whether status is that of an informational
+// response, such as 100 Continue, which precedes the final one. 101
+// Switching Protocols is final: the connection is handed over after it.
+func interimStatus(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// isHTML reports whether a Content-Type is that of an HTML page.
+func isHTML(typ string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(typ)), "text/html")
+}
+
+// gzipHandler compresses responses for clients that accept gzip. Small
+// responses, already compressed types (images, fonts, video) and
+// responses that already carry a Content-Encoding, such as
+// precompressed assets, pass through untouched. So do range requests:
+// byte ranges refer to the uncompressed file, so their 206 responses
+// must be sent as they are, and protocol upgrades, whose connection is
+// handed over rather than answered. HEAD requests get the headers the
+// GET would, going by the Content-Length the handler declares. If exts is non-nil, only requests for paths
+// with one of those extensions are compressed. If overloaded is non-nil
+// and returns true, responses are sent uncompressed to spare the CPU.
+// Clients that refuse every coding the server has, identity included,
+// get a 406. If bufferHTML is set, compressed HTML, such as the index, is
+// held in memory until complete and sent with a Content-Length instead
+// of chunked.
+func gzipHandler(minBytes int, exts map[string]bool, overloaded func() bool, bufferHTML bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := negotiateEncoding(r, serverEncodings); !ok {
+			notAcceptable(w)
+			return
+		}
+		if coding, _ := negotiateEncoding(r, []string{"gzip"}); coding != "gzip" ||
+			r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" ||
+			(exts != nil && !exts[compressExt(r.URL.Path)]) ||
+			(overloaded != nil && overloaded()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			minBytes:       minBytes,
+			head:           r.Method == http.MethodHead,
+			bufferHTML:     bufferHTML,
+		}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// parseExtList turns a comma-separated list of extensions, with or
+// without the leading dot, into a set of lower case extensions.
+func parseExtList(value string) map[string]bool {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil
+	}
+	exts := make(map[string]bool, len(items))
+	for _, ext := range items {
+		exts["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+	}
+	return exts
+}
+
+// compressExt returns the extension a request path is judged by for
+// -compress-ext. Paths without one are app routes answered with the
+// index, so they count as .html.
+func compressExt(p string) string {
+	ext := strings.ToLower(path.Ext(p))
+	if ext == "" {
+		return ".html"
+	}
+	return ext
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPage = strings.Repeat("<p>hello, world</p>\n", 100)
+
+func servePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "index.html", time.Time{}, strings.NewReader(testPage))
+}
+
+func TestGzipHandlerCompresses(t *testing.T) {
+	h := gzipHandler(1024, nil, nil, false, http.HandlerFunc(servePage))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != testPage {
+		t.Error("decompressed body differs from the page")
+	}
+}
+
+func TestGzipHandlerSkipsSmallResponses(t *testing.T) {
+	h := gzipHandler(1<<20, nil, nil, false, http.HandlerFunc(servePage))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if w.Body.String() != testPage {
+		t.Error("body differs from the page")
+	}
+}
+
+func TestGzipHandlerHeadMatchesGet(t *testing.T) {
+	h := gzipHandler(1024, nil, nil, false, http.HandlerFunc(servePage))
+	headers := map[string]http.Header{}
+	for _, method := range []string{"GET", "HEAD"} {
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		headers[method] = w.Header()
+		if method == "HEAD" && w.Body.Len() != 0 {
+			t.Errorf("HEAD sent a %d byte body", w.Body.Len())
+		}
+	}
+	for _, name := range []string{"Content-Encoding", "Content-Length", "Content-Type", "Vary"} {
+		if get, head := headers["GET"].Get(name), headers["HEAD"].Get(name); get != head {
+			t.Errorf("%s: GET has %q, HEAD has %q", name, get, head)
+		}
+	}
+}
+
+func TestGzipHandlerPassesUpgrades(t *testing.T) {
+	var got http.ResponseWriter
+	h := gzipHandler(0, nil, nil, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = w
+	}))
+	r := httptest.NewRequest("GET", "/socket", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got != w {
+		t.Errorf("upgrade request was served through %T", got)
+	}
+}
+
+func TestGzipResponseWriterUnwrap(t *testing.T) {
+	w := httptest.NewRecorder()
+	gw := &gzipResponseWriter{ResponseWriter: w}
+	if gw.Unwrap() != w {
+		t.Error("Unwrap did not return the underlying writer")
+	}
+}
+
+func TestGzipHandlerLeavesRangesAlone(t *testing.T) {
+	h := gzipHandler(0, nil, nil, false, http.HandlerFunc(servePage))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=0-9")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), []byte(testPage[:10])) {
+		t.Errorf("got %d %q, want the first 10 bytes uncompressed", w.Code, w.Body.String())
+	}
+	want := fmt.Sprintf("bytes 0-9/%d", len(testPage))
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Content-Range") != want {
+		t.Errorf("Content-Encoding %q, Content-Range %q, want none and %q",
+			w.Header().Get("Content-Encoding"), w.Header().Get("Content-Range"), want)
+	}
+}
+
+func TestGzipHandlerBuffersIndex(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "index.html"), []byte(testPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spa := spaHandler{staticPath: root, indexPath: "index.html"}
+	srv := httptest.NewServer(gzipHandler(1024, nil, nil, true, spa))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/some/route", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	if len(resp.TransferEncoding) != 0 || resp.ContentLength != int64(len(body)) {
+		t.Errorf("Transfer-Encoding %v, Content-Length %d for a %d byte body",
+			resp.TransferEncoding, resp.ContentLength, len(body))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, _ := ioutil.ReadAll(zr); string(plain) != testPage {
+		t.Error("decompressed body differs from the index")
+	}
+}
+
+func TestGzipHandlerCompressExt(t *testing.T) {
+	exts := parseExtList("JS, .html")
+	if !exts[".js"] || !exts[".html"] || len(exts) != 2 {
+		t.Fatalf("parseExtList = %v", exts)
+	}
+	h := gzipHandler(0, exts, nil, false, http.HandlerFunc(servePage))
+	for path, want := range map[string]string{
+		"/app.js":     "gzip",
+		"/some/route": "gzip",
+		"/data.json":  "",
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != want {
+			t.Errorf("%s: Content-Encoding = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// interimRecorder records the informational responses sent ahead of the
+// final one, which httptest.ResponseRecorder would take as final.
+type interimRecorder struct {
+	*httptest.ResponseRecorder
+	interim []int
+}
+
+func (w *interimRecorder) WriteHeader(status int) {
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.interim = append(w.interim, status)
+		return
+	}
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func TestGzipHandlerPassesInterimResponses(t *testing.T) {
+	h := gzipHandler(0, nil, nil, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusContinue)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(testPage))
+	}))
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := &interimRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, r)
+
+	if len(w.interim) != 1 || w.interim[0] != http.StatusContinue {
+		t.Errorf("interim responses %v, want [100]", w.interim)
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("the final response was not compressed")
+	}
+}
+
+func TestGzipHandlerKeepsSendfile(t *testing.T) {
+	root := writeTree(t, "index.html", "logo.png")
+	if err := ioutil.WriteFile(filepath.Join(root, "app.js"), []byte(testPage), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := gzipHandler(0, nil, nil, false, spaHandler{staticPath: root, indexPath: "index.html"})
+
+	r := httptest.NewRequest("GET", "/logo.png", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "logo.png" || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("png: got %q, Content-Encoding %q", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+	if _, ok := w.src.(*os.File); !ok {
+		t.Errorf("png copied from %T, want *os.File so sendfile can be used", w.src)
+	}
+
+	r = httptest.NewRequest("GET", "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w = &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("js was not compressed")
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(zr); string(body) != testPage {
+		t.Error("compressed js does not decode to the file")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// configEnvPrefix starts the names of the environment variables that
+// settings can be given in, e.g. SPA_PORT for -port.
+const configEnvPrefix = "SPA_"
+
+// configEnvVar returns the environment variable for the named flag.
+func configEnvVar(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// configEnvVars returns the environment variables that hold settings,
+// which must never be exposed to the app.
+func configEnvVars() map[string]bool {
+	vars := map[string]bool{}
+	flag.VisitAll(func(f *flag.Flag) {
+		vars[configEnvVar(f.Name)] = true
+	})
+	return vars
+}
+
+// configPath returns the config file to read: path, or with no path the
+// file named by SPA_CONFIG, if any.
+func configPath(path string) string {
+	if path == "" {
+		path = os.Getenv(configEnvVar("config"))
+	}
+	return path
+}
+
+// applyConfig fills in the flags of fs that weren't given on the command
+// line, first from the JSON config file at path, if any, then from SPA_*
+// environment variables, so that flags beat the environment, which beats
+// the file, which beats the defaults. With no path, the file may be named
+// by SPA_CONFIG.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if path = configPath(path); path != "" {
+		if err := applyConfigFile(fs, path, given); err != nil {
+			return err
+		}
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(configEnvVar(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("%s: %v", configEnvVar(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// applyConfigFile sets the flags of fs not in given from a JSON object
+// keyed by flag name. Repeatable flags may be given a list of values.
+func applyConfigFile(fs *flag.FlagSet, path string, given map[string]bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for name, raw := range settings {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if given[name] {
+			continue
+		}
+		values := []json.RawMessage{raw}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, name, err)
+			}
+		}
+		for _, value := range values {
+			text, err := settingText(value)
+			if err == nil {
+				err = f.Value.Set(text)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// settingText returns a JSON setting value as the text a flag is set
+// from: strings unquoted, numbers and booleans exactly as written.
+func settingText(value json.RawMessage) (string, error) {
+	value = bytes.TrimSpace(value)
+	switch {
+	case bytes.HasPrefix(value, []byte(`"`)):
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	case bytes.Equal(value, []byte("null")), bytes.HasPrefix(value, []byte("{")), bytes.HasPrefix(value, []byte("[")):
+		return "", fmt.Errorf("expected a string, number or boolean, got %s", value)
+	}
+	return string(value), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags returns a flag set with a few settings of each kind.
+func testFlags() (*flag.FlagSet, *int, *string, *bool, hostProxyFlag) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := fs.Int("port", 5000, "")
+	root := fs.String("rootdir", "dist", "")
+	gzip := fs.Bool("gzip", true, "")
+	hosts := hostProxyFlag{}
+	fs.Var(hosts, "proxy-host", "")
+	fs.String("config", "", "")
+	return fs, port, root, gzip, hosts
+}
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	fs, port, root, gzip, _ := testFlags()
+	path := writeConfig(t, `{"port": 8781, "rootdir": "from-file", "gzip": false}`)
+	t.Setenv("SPA_ROOTDIR", "from-env")
+	t.Setenv("SPA_PORT", "8782")
+	if err := fs.Parse([]string{"-port", "8783"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 8783 {
+		t.Errorf("port = %d, want the flag's 8783", *port)
+	}
+	if *root != "from-env" {
+		t.Errorf("rootdir = %q, want the environment's", *root)
+	}
+	if *gzip {
+		t.Error("gzip = true, want the file's false")
+	}
+}
+
+func TestApplyConfigUnknownKey(t *testing.T) {
+	fs, _, _, _, _ := testFlags()
+	path := writeConfig(t, `{"prot": 8781}`)
+	err := applyConfig(fs, path)
+	if err == nil || !strings.Contains(err.Error(), `unknown setting "prot"`) {
+		t.Fatalf("err = %v, want an unknown setting error", err)
+	}
+}
+
+func TestApplyConfigLargeNumbers(t *testing.T) {
+	fs, port, _, _, _ := testFlags()
+	path := writeConfig(t, `{"port": 1048576}`)
+	if err := applyConfig(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 1048576 {
+		t.Errorf("port = %d, want 1048576", *port)
+	}
+}
+
+func TestApplyConfigLists(t *testing.T) {
+	fs, _, _, _, hosts := testFlags()
+	path := writeConfig(t, `{"proxy-host": ["a.test=http://127.0.0.1:1", "b.test=http://127.0.0.1:2"]}`)
+	if err := applyConfig(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Errorf("got %d proxy hosts, want 2", len(hosts))
+	}
+}
+
+func TestApplyConfigFromEnvironment(t *testing.T) {
+	fs, port, _, _, _ := testFlags()
+	t.Setenv("SPA_CONFIG", writeConfig(t, `{"port": 8781}`))
+	if err := applyConfig(fs, ""); err != nil {
+		t.Fatal(err)
+	}
+	if *port != 8781 {
+		t.Errorf("port = %d, want 8781 from the SPA_CONFIG file", *port)
+	}
+}
+
+func TestApplyConfigBadEnvironment(t *testing.T) {
+	fs, _, _, _, _ := testFlags()
+	t.Setenv("SPA_PORT", "many")
+	err := applyConfig(fs, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "SPA_PORT:") {
+		t.Fatalf("err = %v, want a SPA_PORT error", err)
+	}
+}
+
+func TestApplyConfigRejectsObjects(t *testing.T) {
+	fs, _, _, _, _ := testFlags()
+	path := writeConfig(t, `{"rootdir": {"a": 1}}`)
+	if err := applyConfig(fs, path); err == nil {
+		t.Fatal("expected an error for an object value")
+	}
+}
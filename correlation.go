@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// requestIDHeader carries the ID used to correlate a request across
+// services.
+const requestIDHeader = "X-Request-Id"
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// forwardCorrelation makes sure the named correlation headers reach the
+// upstream of a proxied request. They are removed from the Connection
+// header so they can't be stripped as hop-by-hop, and if X-Request-ID is
+// among them but missing, one is generated.
+func forwardCorrelation(req *http.Request, names []string) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		keep[name] = true
+		if name == requestIDHeader && req.Header.Get(name) == "" {
+			req.Header.Set(name, newRequestID())
+		}
+	}
+
+	var conn []string
+	for _, field := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(field, ",") {
+			token = strings.TrimSpace(token)
+			if token != "" && !keep[http.CanonicalHeaderKey(token)] {
+				conn = append(conn, token)
+			}
+		}
+	}
+	if len(conn) > 0 {
+		req.Header.Set("Connection", strings.Join(conn, ", "))
+	} else {
+		req.Header.Del("Connection")
+	}
+}
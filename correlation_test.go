@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardCorrelation(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer upstream.Close()
+	targets, err := parseUpstreams(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newProxy(targets, proxyOptions{forwardHeaders: []string{"X-Request-Id", "traceparent"}})
+
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set("Connection", "traceparent, X-Other")
+	r.Header.Set("Traceparent", "00-abc-def-01")
+	r.Header.Set("X-Other", "dropped")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got.Get("Traceparent") != "00-abc-def-01" {
+		t.Errorf("traceparent listed in Connection was stripped")
+	}
+	if got.Get("X-Other") != "" {
+		t.Errorf("hop-by-hop X-Other reached the upstream")
+	}
+	if len(got.Get(requestIDHeader)) != 32 {
+		t.Errorf("X-Request-Id = %q, want a generated ID", got.Get(requestIDHeader))
+	}
+
+	r = httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set(requestIDHeader, "from-client")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got.Get(requestIDHeader) != "from-client" {
+		t.Errorf("X-Request-Id = %q, want the client's", got.Get(requestIDHeader))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+)
+
+// counterShard is one slot of a shardedCounter, padded out to a cache
+// line so that shards updated from different CPUs don't contend.
+type counterShard struct {
+	n int64
+	_ [56]byte
+}
+
+// shardedCounter is a counter split over several atomics, summed when
+// read. Under many concurrent requests a single atomic becomes a point
+// of contention between CPUs; spreading the updates avoids that.
+type shardedCounter struct {
+	shards []counterShard
+	mask   uint32
+}
+
+// newShardedCounter returns a counter with a few shards per CPU, rounded
+// up to a power of two.
+func newShardedCounter() *shardedCounter {
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	return &shardedCounter{shards: make([]counterShard, n), mask: uint32(n - 1)}
+}
+
+// add adds delta to the shard picked by key.
+func (c *shardedCounter) add(key uint32, delta int64) {
+	atomic.AddInt64(&c.shards[key&c.mask].n, delta)
+}
+
+// load returns the sum over all shards.
+func (c *shardedCounter) load() int64 {
+	var sum int64
+	for i := range c.shards {
+		sum += atomic.LoadInt64(&c.shards[i].n)
+	}
+	return sum
+}
+
+// shardKey picks the shard for one request's counts. Go has no way to
+// ask which CPU a goroutine runs on, so each request picks a shard at
+// random. The connection won't do as a key: traffic through a proxy or
+// over one HTTP/2 connection would all land on the same shard. The
+// generator in math/rand/v2 keeps its state per CPU, so drawing from it
+// neither allocates nor contends.
+func shardKey() uint32 {
+	return rand.Uint32()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedCounter(t *testing.T) {
+	c := newShardedCounter()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.add(shardKey(), 2)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := c.load(); got != 16000 {
+		t.Errorf("load() = %d, want 16000", got)
+	}
+}
+
+func TestShardKeySpreads(t *testing.T) {
+	c := newShardedCounter()
+	for i := 0; i < 100*len(c.shards); i++ {
+		c.add(shardKey(), 1)
+	}
+	used := 0
+	for i := range c.shards {
+		if c.shards[i].n > 0 {
+			used++
+		}
+	}
+	if used < len(c.shards)/2 {
+		t.Errorf("requests landed on %d of %d shards", used, len(c.shards))
+	}
+}
+
+func TestShardKeyAllocs(t *testing.T) {
+	if n := testing.AllocsPerRun(100, func() { shardKey() }); n != 0 {
+		t.Errorf("shardKey allocates %v times", n)
+	}
+}
+
+// BenchmarkShardedCounter compares the sharded counter against a single
+// atomic under parallel updates.
+func BenchmarkShardedCounter(b *testing.B) {
+	b.Run("sharded", func(b *testing.B) {
+		c := newShardedCounter()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c.add(shardKey(), 1)
+			}
+		})
+	})
+	b.Run("single", func(b *testing.B) {
+		var n int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				atomic.AddInt64(&n, 1)
+			}
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// loadSampleInterval is how often the load is sampled. The kernel only
+// updates the load average every five seconds.
+const loadSampleInterval = 5 * time.Second
+
+// loadMonitor samples the system load in the background so that
+// requests can cheaply check whether the machine is overloaded.
+type loadMonitor struct {
+	threshold float64
+	// load holds the bits of the last sampled float64 load
+	load uint64
+}
+
+// newLoadMonitor takes a first sample with read and keeps sampling
+// every interval. The monitor reports overload while a sample is above
+// threshold.
+func newLoadMonitor(threshold float64, read func() (float64, error), interval time.Duration) (*loadMonitor, error) {
+	load, err := read()
+	if err != nil {
+		return nil, err
+	}
+	m := &loadMonitor{threshold: threshold}
+	m.store(load)
+	go func() {
+		for range time.Tick(interval) {
+			if load, err := read(); err == nil {
+				m.store(load)
+			}
+		}
+	}()
+	return m, nil
+}
+
+func (m *loadMonitor) store(load float64) {
+	atomic.StoreUint64(&m.load, math.Float64bits(load))
+}
+
+// overloaded reports whether the last sample was above the threshold.
+func (m *loadMonitor) overloaded() bool {
+	return math.Float64frombits(atomic.LoadUint64(&m.load)) > m.threshold
+}
+
+// readLoadAvg returns the one-minute load average per CPU, so 1 means
+// every CPU is busy.
+func readLoadAvg() (float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg contents %q", data)
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return load / float64(runtime.NumCPU()), nil
+}
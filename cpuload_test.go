@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadMonitor(t *testing.T) {
+	var load atomic.Value
+	load.Store(0.5)
+	read := func() (float64, error) { return load.Load().(float64), nil }
+	m, err := newLoadMonitor(0.8, read, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.overloaded() {
+		t.Error("overloaded below the threshold")
+	}
+
+	load.Store(0.9)
+	deadline := time.Now().Add(time.Second)
+	for !m.overloaded() {
+		if time.Now().After(deadline) {
+			t.Fatal("a sample above the threshold was never picked up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoadMonitorReadError(t *testing.T) {
+	read := func() (float64, error) { return 0, errors.New("no load") }
+	if _, err := newLoadMonitor(1, read, time.Hour); err == nil {
+		t.Error("expected the first sample's error")
+	}
+}
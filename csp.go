@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// maxCSPReportSize bounds how much of a violation report is read.
+const maxCSPReportSize = 64 << 10
+
+// cspReportOnly wraps a handler so every response carries the given
+// policy as Content-Security-Policy-Report-Only. Browsers report
+// violations to reportURI, if set, without blocking anything.
+func cspReportOnly(policy, reportURI string, next http.Handler) http.Handler {
+	if reportURI != "" {
+		policy += "; report-uri " + reportURI
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy-Report-Only", policy)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cspReportHandler accepts the JSON violation reports that browsers POST
+// to the report-uri and logs them.
+func cspReportHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var report bytes.Buffer
+	if err := json.Compact(&report, body); err != nil {
+		http.Error(w, "invalid report", http.StatusBadRequest)
+		return
+	}
+	log.Printf("CSP violation from %s: %s\n", r.RemoteAddr, report.String())
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSPReportOnly(t *testing.T) {
+	h := cspReportOnly("default-src 'self'", "/csp-report", http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	want := "default-src 'self'; report-uri /csp-report"
+	if got := w.Header().Get("Content-Security-Policy-Report-Only"); got != want {
+		t.Errorf("policy = %q, want %q", got, want)
+	}
+	if w.Header().Get("Content-Security-Policy") != "" {
+		t.Error("report-only mode set an enforced policy")
+	}
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	buf := captureLog(t)
+	report := `{
+		"csp-report": {"blocked-uri": "https://evil.example"}
+	}`
+	w := httptest.NewRecorder()
+	cspReportHandler(w, httptest.NewRequest("POST", "/csp-report", strings.NewReader(report)))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	if !strings.Contains(buf.String(), `{"csp-report":{"blocked-uri":"https://evil.example"}}`) {
+		t.Errorf("logged %q, want the compacted report", buf.String())
+	}
+
+	w = httptest.NewRecorder()
+	cspReportHandler(w, httptest.NewRequest("POST", "/csp-report", strings.NewReader("not json")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid report: status = %d, want 400", w.Code)
+	}
+
+	big := strings.NewReader(`"` + strings.Repeat("x", maxCSPReportSize) + `"`)
+	w = httptest.NewRecorder()
+	cspReportHandler(w, httptest.NewRequest("POST", "/csp-report", big))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized report: status = %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// bodyLogger logs truncated, redacted request and response bodies for a
+// sample of requests, to help debug what goes through the proxy.
+type bodyLogger struct {
+	sample float64
+	limit  int
+	// headers are the (canonical) header names whose values are hidden
+	headers map[string]bool
+	// fields matches JSON fields whose values are hidden
+	fields *regexp.Regexp
+}
+
+// newBodyLogger logs a sample fraction of requests, keeping at most
+// limit bytes of each body. Each redacted name hides the header of that
+// name and any JSON field of that name.
+func newBodyLogger(sample float64, limit int, redacted []string) *bodyLogger {
+	l := &bodyLogger{
+		sample:  sample,
+		limit:   limit,
+		headers: make(map[string]bool),
+	}
+	quoted := make([]string, len(redacted))
+	for i, name := range redacted {
+		l.headers[http.CanonicalHeaderKey(name)] = true
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	if len(quoted) > 0 {
+		l.fields = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") +
+			`)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+	return l
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// teeReadCloser copies what is read from a body into a buffer.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyCaptureWriter copies the response body into a buffer.
+type bodyCaptureWriter struct {
+	*statusRecorder
+	body *limitedBuffer
+}
+
+func (w bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.statusRecorder.Write(b)
+}
+
+// ReadFrom copies through Write, so the body is captured rather than
+// sent around it by statusRecorder's ReadFrom.
+func (w bodyCaptureWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+func (l *bodyLogger) redactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if l.headers[name] {
+			values = []string{"[REDACTED]"}
+		}
+		out[name] = values
+	}
+	return out
+}
+
+func (l *bodyLogger) redactBody(b *limitedBuffer) string {
+	body := b.String()
+	if l.fields != nil {
+		body = l.fields.ReplaceAllString(body, `$1"[REDACTED]"`)
+	}
+	if b.truncated {
+		body += "...(truncated)"
+	}
+	return body
+}
+
+// wrap logs the bodies of a sampled fraction of requests to next.
+func (l *bodyLogger) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= l.sample {
+			next.ServeHTTP(w, r)
+			return
+		}
+		reqBody := &limitedBuffer{limit: l.limit}
+		if r.Body != nil {
+			r.Body = teeReadCloser{io.TeeReader(r.Body, reqBody), r.Body}
+		}
+		respBody := &limitedBuffer{limit: l.limit}
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(bodyCaptureWriter{sr, respBody}, r)
+
+		log.Printf("debug: %s %s request headers=%v body=%q response status=%d headers=%v body=%q\n",
+			r.Method, r.URL.RequestURI(),
+			l.redactHeaders(r.Header), l.redactBody(reqBody),
+			sr.status, l.redactHeaders(w.Header()), l.redactBody(respBody))
+	})
+}
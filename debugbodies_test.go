@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLogger(t *testing.T) {
+	buf := captureLog(t)
+	l := newBodyLogger(1, 40, []string{"password", "authorization"})
+	h := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"token": "abc", "password":"hunter2"}` + strings.Repeat(" ", 40)))
+	}))
+
+	r := httptest.NewRequest("POST", "/login", strings.NewReader(`{"user":"ann","password":"hunter2"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	logged := buf.String()
+	for _, leak := range []string{"hunter2", "Bearer secret"} {
+		if strings.Contains(logged, leak) {
+			t.Errorf("log leaks %q: %s", leak, logged)
+		}
+	}
+	for _, want := range []string{`\"user\":\"ann\"`, "[REDACTED]", "...(truncated)", "status=200"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log lacks %q: %s", want, logged)
+		}
+	}
+}
+
+func TestBodyLoggerSample(t *testing.T) {
+	buf := captureLog(t)
+	h := newBodyLogger(0, 40, nil).wrap(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if buf.Len() != 0 {
+		t.Errorf("logged with a zero sample rate: %s", buf.String())
+	}
+}
+
+func TestBodyLoggerCapturesFiles(t *testing.T) {
+	buf := captureLog(t)
+	root := writeTree(t, "index.html", "app.js")
+	h := newBodyLogger(1, 100, nil).wrap(spaHandler{staticPath: root, indexPath: "index.html"})
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if w.Body.String() != "app.js" {
+		t.Fatalf("got %q", w.Body.String())
+	}
+	if !strings.Contains(buf.String(), `body="app.js"`) {
+		t.Errorf("log lacks the response body: %s", buf.String())
+	}
+}
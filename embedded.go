@@ -0,0 +1,28 @@
+//go:build embed
+// +build embed
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed dist
+var dist embed.FS
+
+// pluginAssets are further embedded filesystems, such as plugins', that
+// are served alongside dist/. Files compiled in with the embed tag add
+// theirs from an init function; dist/ takes precedence, then plugins in
+// the order they were added.
+var pluginAssets []fs.FS
+
+// embeddedAssets returns the app compiled into the binary from dist/,
+// merged with any plugin assets.
+func embeddedAssets() fs.FS {
+	assets, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return mergeFS(append([]fs.FS{assets}, pluginAssets...)...)
+}
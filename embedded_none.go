@@ -0,0 +1,12 @@
+//go:build !embed
+// +build !embed
+
+package main
+
+import "io/fs"
+
+// embeddedAssets returns nil: build with -tags embed to compile the app
+// in dist/ into the binary.
+func embeddedAssets() fs.FS {
+	return nil
+}
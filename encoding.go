@@ -0,0 +1,170 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// serverEncodings are the content codings the server can respond with,
+// on the fly or precompressed, in order of preference.
+var serverEncodings = []string{"br", "gzip"}
+
+// acceptedCoding is one entry of an Accept-Encoding header.
+type acceptedCoding struct {
+	coding string
+	q      float64
+}
+
+// parseAcceptEncoding returns the codings listed in the request's
+// Accept-Encoding, highest q-value first and in the client's order among
+// equals. Entries with q=0 are kept, since they forbid a coding; entries
+// with a malformed q-value are dropped.
+func parseAcceptEncoding(r *http.Request) []acceptedCoding {
+	var accepted []acceptedCoding
+	for _, field := range r.Header.Values("Accept-Encoding") {
+		for _, item := range strings.Split(field, ",") {
+			parts := strings.Split(item, ";")
+			coding := strings.ToLower(strings.TrimSpace(parts[0]))
+			if coding == "" {
+				continue
+			}
+			q, ok := 1.0, true
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+					var err error
+					q, err = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+					ok = err == nil && q >= 0 && q <= 1
+				}
+			}
+			if ok {
+				accepted = append(accepted, acceptedCoding{coding: coding, q: q})
+			}
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+	return accepted
+}
+
+// encodingQuality returns the q-value the client gives coding: that of
+// its own entry, else that of *, else 0. Identity is acceptable unless
+// excluded, but when not listed it gets the lowest q-value there is, so
+// any coding the client lists is preferred to it.
+func encodingQuality(accepted []acceptedCoding, coding string) float64 {
+	wildcard := -1.0
+	for _, a := range accepted {
+		if a.coding == coding {
+			return a.q
+		}
+		if a.coding == "*" && wildcard < 0 {
+			wildcard = a.q
+		}
+	}
+	if wildcard >= 0 {
+		return wildcard
+	}
+	if coding == "identity" {
+		return 0.001
+	}
+	return 0
+}
+
+// negotiateEncoding picks the coding to respond with: one of offered,
+// which are in the server's order of preference, or identity. The
+// highest q-value wins, ties going to the server's preference with
+// identity last. ok is false if the client accepts none of them, not
+// even identity.
+func negotiateEncoding(r *http.Request, offered []string) (coding string, ok bool) {
+	accepted := parseAcceptEncoding(r)
+	best, bestQ := "identity", encodingQuality(accepted, "identity")
+	for i := len(offered) - 1; i >= 0; i-- {
+		if q := encodingQuality(accepted, offered[i]); q > 0 && q >= bestQ {
+			best, bestQ = offered[i], q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows
+// the given content coding, taking q-values and * into account.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	return encodingQuality(parseAcceptEncoding(r), strings.ToLower(coding)) > 0
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	return acceptsEncoding(r, "gzip")
+}
+
+// notAcceptable responds with a 406 to a client that refuses every
+// coding the server could send, identity included.
+func notAcceptable(w http.ResponseWriter) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+}
+
+// siblingEncodings are the precompressed variants looked for next to a
+// file, in order of preference, with the extension they are stored
+// under.
+var siblingEncodings = []struct {
+	coding string
+	ext    string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// servePrecompressed serves a build-time compressed sibling of the file
+// at path (file.br or file.gz) if one exists and the client prefers its
+// encoding, reporting whether it did. A client that accepts neither the
+// siblings nor the file itself gets a 406. Siblings for which skip
+// returns true are ignored; skip may be nil.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, path string, skip func(string) bool) bool {
+	var offered []string
+	exts := map[string]string{}
+	for _, enc := range siblingEncodings {
+		info, err := os.Stat(path + enc.ext)
+		if err != nil || info.IsDir() || (skip != nil && skip(path+enc.ext)) {
+			continue
+		}
+		offered = append(offered, enc.coding)
+		exts[enc.coding] = enc.ext
+	}
+	if len(offered) == 0 {
+		return false
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	coding, ok := negotiateEncoding(r, offered)
+	if !ok {
+		notAcceptable(w)
+		return true
+	}
+	if coding == "identity" {
+		return false
+	}
+
+	f, err := os.Open(path + exts[coding])
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if w.Header().Get("Content-Type") == "" {
+		if typ := mime.TypeByExtension(filepath.Ext(path)); typ != "" {
+			w.Header().Set("Content-Type", typ)
+		}
+	}
+	w.Header().Set("Content-Encoding", coding)
+	http.ServeContent(w, r, path, info.ModTime(), f)
+	return true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// acceptEncodingRequest returns a request with one Accept-Encoding
+// field per value.
+func acceptEncodingRequest(values ...string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, v := range values {
+		r.Header.Add("Accept-Encoding", v)
+	}
+	return r
+}
+
+func TestParseAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"gzip"}, "gzip=1"},
+		{[]string{"GZIP, Br"}, "gzip=1 br=1"},
+		{[]string{"a;q=0.5, b, c;q=0.5"}, "b=1 a=0.5 c=0.5"},
+		{[]string{"gzip;q=0"}, "gzip=0"},
+		{[]string{"gzip;q=abc, br;q=2, deflate;q=-1, identity"}, "identity=1"},
+		{[]string{"gzip ; Q=0.8", "br;q=0.9"}, "br=0.9 gzip=0.8"},
+		{[]string{" , ,gzip"}, "gzip=1"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, a := range parseAcceptEncoding(acceptEncodingRequest(tt.fields...)) {
+			got = append(got, a.coding+"="+strconv.FormatFloat(a.q, 'g', -1, 64))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"br", "gzip"}
+	tests := []struct {
+		fields []string
+		want   string
+		ok     bool
+	}{
+		{nil, "identity", true},
+		{[]string{"gzip"}, "gzip", true},
+		{[]string{"gzip, br"}, "br", true},
+		{[]string{"gzip;q=1, br;q=0.5"}, "gzip", true},
+		{[]string{"*"}, "br", true},
+		{[]string{"br;q=0, *"}, "gzip", true},
+		{[]string{"identity, gzip"}, "gzip", true},
+		{[]string{"identity;q=1, gzip;q=0.5"}, "identity", true},
+		{[]string{"gzip;q=0.5", "br;q=0.8"}, "br", true},
+		{[]string{"gzip;q=bogus"}, "identity", true},
+		{[]string{"deflate"}, "identity", true},
+		{[]string{"identity;q=0"}, "identity", false},
+		{[]string{"*;q=0"}, "identity", false},
+	}
+	for _, tt := range tests {
+		got, ok := negotiateEncoding(acceptEncodingRequest(tt.fields...), offered)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: got %s, %v, want %s, %v", tt.fields, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"Gzip", true},
+		{"gzip;q=0", false},
+		{"gzip;q=0.001", true},
+		{"*", true},
+		{"*, gzip;q=0", false},
+		{"*;q=0, gzip", true},
+		{"deflate, br", false},
+		{"x-gzip", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsEncoding(acceptEncodingRequest(tt.header), "gzip"); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, gzip) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestServePrecompressed(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js", "app.js.br", "app.js.gz", "style.css", "style.css.gz")
+	h := spaHandler{staticPath: root, indexPath: "index.html", precompressed: true}
+	tests := []struct {
+		path, accept   string
+		encoding, body string
+	}{
+		{"/app.js", "gzip, br", "br", "app.js.br"},
+		{"/app.js", "gzip", "gzip", "app.js.gz"},
+		{"/app.js", "", "", "app.js"},
+		{"/style.css", "br, gzip", "gzip", "style.css.gz"},
+		{"/", "gzip", "", "index.html"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept-Encoding", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding || w.Body.String() != tt.body {
+			t.Errorf("%s with %q: got %q encoded %q, want %q encoded %q",
+				tt.path, tt.accept, w.Body.String(), got, tt.body, tt.encoding)
+		}
+		if tt.path == "/app.js" && w.Header().Get("Content-Type") != "text/javascript; charset=utf-8" {
+			t.Errorf("%s with %q: Content-Type = %q", tt.path, tt.accept, w.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// envInjector adds a window.__ENV__ script holding the environment
+// variables whose names start with prefix to index files.
+type envInjector struct {
+	prefix string
+	// hidden are variables never exposed, such as the server's own
+	// SPA_* settings
+	hidden map[string]bool
+}
+
+func newEnvInjector(prefix string, hidden map[string]bool) *envInjector {
+	return &envInjector{prefix: prefix, hidden: hidden}
+}
+
+// script renders the matching environment as a script element.
+// json.Marshal escapes <, > and &, so values can't close the element.
+func (e *envInjector) script() ([]byte, error) {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], e.prefix) && !e.hidden[parts[0]] {
+			env[parts[0]] = parts[1]
+		}
+	}
+	values, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("<script>window.__ENV__ = " + string(values) + ";</script>"), nil
+}
+
+// inject returns src with the script inserted right before </head>, or
+// at the very start if it has no head.
+func (e *envInjector) inject(src []byte) ([]byte, error) {
+	script, err := e.script()
+	if err != nil {
+		return nil, err
+	}
+	at := bytes.Index(bytes.ToLower(src), []byte("</head>"))
+	if at < 0 {
+		at = 0
+	}
+	body := make([]byte, 0, len(src)+len(script))
+	body = append(body, src[:at]...)
+	body = append(body, script...)
+	body = append(body, src[at:]...)
+	return body, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvInjector(t *testing.T) {
+	t.Setenv("PUBLIC_API", "https://api.example.com</script>")
+	t.Setenv("PUBLIC_SECRET", "hidden")
+	t.Setenv("OTHER", "unrelated")
+	e := newEnvInjector("PUBLIC_", map[string]bool{"PUBLIC_SECRET": true})
+
+	got, err := e.inject([]byte("<html><HEAD><title>x</title></HEAD><body></body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(got)
+	want := `<script>window.__ENV__ = {"PUBLIC_API":"https://api.example.com\u003c/script\u003e"};</script></HEAD>`
+	if !strings.Contains(page, want) {
+		t.Errorf("page lacks the script before </head>:\n%s", page)
+	}
+	for _, leak := range []string{"hidden", "unrelated"} {
+		if strings.Contains(page, leak) {
+			t.Errorf("page exposes %q", leak)
+		}
+	}
+
+	got, err = e.inject([]byte("<div></div>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "<script>") || !strings.HasSuffix(string(got), "<div></div>") {
+		t.Errorf("headless page = %q, want the script first", got)
+	}
+}
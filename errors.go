@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// jsonError is the body of the server's JSON error responses.
+type jsonError struct {
+	Error string `json:"error"`
+	// Code is a stable, machine-readable name for the error
+	Code string `json:"code,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// writeJSONError responds with status and a JSON error body.
+func writeJSONError(w http.ResponseWriter, status int, body jsonError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// acceptsJSON reports whether the client asked for JSON, as API clients
+// do, rather than leaving the response type up to the server.
+func acceptsJSON(r *http.Request) bool {
+	for _, item := range strings.Split(r.Header.Get("Accept"), ",") {
+		typ, _, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		if typ == "application/json" || strings.HasSuffix(typ, "+json") {
+			return true
+		}
+	}
+	return false
+}
+
+// badRequest responds with a 400, as JSON carrying code if the client
+// accepts it and as plain text otherwise.
+func badRequest(w http.ResponseWriter, r *http.Request, code, message string) {
+	if acceptsJSON(r) {
+		writeJSONError(w, http.StatusBadRequest, jsonError{Error: message, Code: code, Path: r.URL.Path})
+		return
+	}
+	http.Error(w, message, http.StatusBadRequest)
+}
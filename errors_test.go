@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIPrefixNotFound(t *testing.T) {
+	root := writeTree(t, "index.html")
+	h := spaHandler{staticPath: root, indexPath: "index.html", apiPrefix: "/api"}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s, want a JSON 404", w.Code, w.Header().Get("Content-Type"))
+	}
+	var body jsonError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "not found" || body.Path != "/api/users" {
+		t.Errorf("body = %+v", body)
+	}
+
+	// routes that merely start with the prefix still get the app
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/apis", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "index.html" {
+		t.Errorf("/apis: got %d %q, want the index", w.Code, w.Body.String())
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	tests := []struct {
+		accept, contentType string
+	}{
+		{"application/json", "application/json"},
+		{"text/html, application/problem+json;q=0.9", "application/json"},
+		{"text/html", "text/plain; charset=utf-8"},
+		{"", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/a", nil)
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		badRequest(w, r, "invalid_characters", "invalid characters in path")
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Accept %q: got %d %s, want 400 %s", tt.accept, w.Code, w.Header().Get("Content-Type"), tt.contentType)
+			continue
+		}
+		if tt.contentType == "application/json" {
+			var body jsonError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "invalid_characters" {
+				t.Errorf("Accept %q: body %q", tt.accept, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// strongETag returns a strong ETag for body, from its SHA-256 hash.
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+// etagEntry is the ETag of a file as of a modification time and size.
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etagCache remembers the content hash ETags of files that are served
+// often, such as the index, so they are only re-read when their
+// modification time or size changes.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{entries: make(map[string]etagEntry)}
+}
+
+// etag returns the ETag of the file called name, described by info,
+// calling open to read it if the cached ETag is out of date.
+func (c *etagCache) etag(name string, info os.FileInfo, open func() (io.ReadCloser, error)) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.etag, nil
+	}
+
+	f, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	e = etagEntry{modTime: info.ModTime(), size: info.Size(), etag: strongETag(body)}
+
+	c.mu.Lock()
+	c.entries[name] = e
+	c.mu.Unlock()
+	return e.etag, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexETagRevalidation(t *testing.T) {
+	root := writeTree(t, "index.html")
+	generated, err := newGeneratedIndex("App", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := map[string]http.Handler{
+		"disk":      spaHandler{staticPath: root, indexPath: "index.html", etags: newETagCache()},
+		"embedded":  spaHandler{indexPath: "index.html", etags: newETagCache(), fsys: http.FS(fstest.MapFS{"index.html": {Data: []byte("index")}})},
+		"generated": spaHandler{staticPath: t.TempDir(), indexPath: "index.html", generated: generated},
+		"gzip":      gzipHandler(0, nil, nil, false, spaHandler{staticPath: root, indexPath: "index.html", etags: newETagCache()}),
+	}
+	for name, h := range handlers {
+		for _, path := range []string{"/", "/some/route"} {
+			r := httptest.NewRequest("GET", path, nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			etag := w.Header().Get("ETag")
+			if w.Code != http.StatusOK || etag == "" {
+				t.Errorf("%s %s: got %d with ETag %q, want a 200 with one", name, path, w.Code, etag)
+				continue
+			}
+
+			r = httptest.NewRequest("GET", path, nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			r.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("%s %s: If-None-Match %s got %d, want 304", name, path, etag, w.Code)
+			}
+
+			r = httptest.NewRequest("GET", path, nil)
+			r.Header.Set("If-None-Match", `"stale"`)
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("%s %s: stale If-None-Match got %d, want 200", name, path, w.Code)
+			}
+		}
+	}
+}
+
+func TestGzipWeakensETag(t *testing.T) {
+	root := writeTree(t, "index.html")
+	h := gzipHandler(0, nil, nil, false, spaHandler{staticPath: root, indexPath: "index.html", etags: newETagCache()})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	if etag := w.Header().Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		t.Errorf("gzipped response kept the strong ETag %s", etag)
+	}
+}
+
+func TestETagCache(t *testing.T) {
+	c := newETagCache()
+	root := writeTree(t, "index.html")
+	h := spaHandler{staticPath: root, indexPath: "index.html", etags: c}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(c.entries) != 1 {
+		t.Errorf("%d cached ETags, want 1", len(c.entries))
+	}
+	for _, e := range c.entries {
+		if e.etag != strongETag([]byte("index.html")) {
+			t.Errorf("cached ETag %s is not the content hash", e.etag)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+)
+
+// serveFS is ServeHTTP for assets served from h.fsys rather than from a
+// directory on disk. Features that need real files (markdown, the file
+// and gzip caches, precompressed siblings, symlink checks) don't apply.
+func (h spaHandler) serveFS(w http.ResponseWriter, r *http.Request) {
+	// http.FileSystem names are always slash-separated and rooted, and
+	// cleaning removes any ".." before it is opened
+	name := path.Clean("/" + r.URL.Path)
+	f, err := h.fsys.Open(name)
+	if os.IsNotExist(err) {
+		h.serveMissing(w, r, name)
+		return
+	} else if err != nil {
+		if err == fs.ErrInvalid {
+			badRequest(w, r, "invalid_path", "invalid path")
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.debugServedFile {
+		served := name
+		if info.IsDir() {
+			served = path.Join(name, "index.html")
+		}
+		w.Header().Set("X-Served-File", served[1:])
+	}
+	h.setStaticHeaders(w.Header(), name, info.IsDir(), name == "/"+h.indexPath)
+	if h.nosniff && !info.IsDir() {
+		setDeclaredType(w.Header(), name)
+	}
+	if h.etags != nil && (name == "/"+h.indexPath || name == "/") {
+		// the shell, requested directly; http.FileServer serves / from
+		// the root's index.html
+		indexName := name
+		if info.IsDir() {
+			indexName = "/index.html"
+		}
+		h.setIndexETagFS(w.Header(), indexName)
+	}
+	http.FileServer(h.fsys).ServeHTTP(w, r)
+}
+
+// serveIndexFS serves the first index file that exists in h.fsys.
+func (h spaHandler) serveIndexFS(w http.ResponseWriter, r *http.Request) {
+	for _, name := range append([]string{h.indexPath}, h.altIndexes...) {
+		f, err := h.fsys.Open("/" + name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if info.IsDir() {
+			log.Printf("index %s is a directory\n", name)
+			http.Error(w, fmt.Sprintf("index %s is a directory, not a file", name), http.StatusInternalServerError)
+			return
+		}
+		if h.debugServedFile {
+			w.Header().Set("X-Served-File", name)
+		}
+		if h.etags != nil {
+			h.setIndexETagFS(w.Header(), "/"+name)
+		}
+		http.ServeContent(w, r, name, info.ModTime(), f)
+		return
+	}
+	if h.generated != nil {
+		h.generated.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// setIndexETagFS sets the ETag of the index called name in h.fsys.
+// Embedded files have no modification time to revalidate by.
+func (h spaHandler) setIndexETagFS(header http.Header, name string) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil || info.IsDir() {
+		return
+	}
+	open := func() (io.ReadCloser, error) { return h.fsys.Open(name) }
+	if etag, err := h.etags.etag(name, info, open); err == nil {
+		header.Set("ETag", etag)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("embedded index")},
+		"assets/app.js":   {Data: []byte("embedded app")},
+		"docs/index.html": {Data: []byte("embedded docs")},
+	}
+	h := spaHandler{indexPath: "index.html", fsys: http.FS(fsys)}
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/assets/app.js", http.StatusOK, "embedded app"},
+		{"/docs/", http.StatusOK, "embedded docs"},
+		{"/", http.StatusOK, "embedded index"},
+		{"/some/route", http.StatusOK, "embedded index"},
+		{"/assets/missing.js", http.StatusOK, "embedded index"},
+		{"/../../etc/passwd", http.StatusOK, "embedded index"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestServeFSWithoutIndex(t *testing.T) {
+	fsys := fstest.MapFS{"app.js": {Data: []byte("app")}}
+	h := spaHandler{indexPath: "index.html", fsys: http.FS(fsys)}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 without an index", w.Code)
+	}
+
+	g, err := newGeneratedIndex("App", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.generated = g
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("got %d with %d bytes, want the generated shell", w.Code, w.Body.Len())
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+var generatedIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+</head>
+<body>
+<div id="{{.RootID}}"></div>
+</body>
+</html>
+`))
+
+// generatedIndex is a minimal SPA shell served when the static directory
+// has no index file of its own.
+type generatedIndex struct {
+	body    []byte
+	etag    string
+	modTime time.Time
+}
+
+func newGeneratedIndex(title, rootID string) (*generatedIndex, error) {
+	var buf bytes.Buffer
+	err := generatedIndexTemplate.Execute(&buf, struct{ Title, RootID string }{title, rootID})
+	if err != nil {
+		return nil, err
+	}
+	return &generatedIndex{body: buf.Bytes(), etag: strongETag(buf.Bytes()), modTime: time.Now()}, nil
+}
+
+func (g *generatedIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", g.etag)
+	http.ServeContent(w, r, "index.html", g.modTime, bytes.NewReader(g.body))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedIndex(t *testing.T) {
+	g, err := newGeneratedIndex("My <App>", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := writeTree(t, "app.js")
+	h := spaHandler{staticPath: root, indexPath: "index.html", generated: g}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"<title>My &lt;App&gt;</title>", `<div id="root"></div>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("shell lacks %s:\n%s", want, body)
+		}
+	}
+
+	// a real index wins
+	root = writeTree(t, "index.html")
+	h.staticPath = root
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Body.String() != "index.html" {
+		t.Errorf("with an index on disk got %q", w.Body.String())
+	}
+}
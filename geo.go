@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseLocaleMap parses a comma-separated list of COUNTRY=/path/ pairs.
+func parseLocaleMap(value string) (map[string]string, error) {
+	locales := make(map[string]string)
+	for _, pair := range splitList(value) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("expected COUNTRY=/path/, got %q", pair)
+		}
+		locales[strings.ToUpper(parts[0])] = parts[1]
+	}
+	return locales, nil
+}
+
+// localeRedirect redirects to a locale prefix chosen by the country a
+// CDN reports in header, or to fallback for unmapped countries. Without
+// a target it leaves the request to next.
+type localeRedirect struct {
+	header   string
+	locales  map[string]string
+	fallback string
+	next     http.Handler
+}
+
+func (h localeRedirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", h.header)
+	target, ok := h.locales[strings.ToUpper(r.Header.Get(h.header))]
+	if !ok {
+		target = h.fallback
+	}
+	if target == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLocaleMap(t *testing.T) {
+	locales, err := parseLocaleMap("de=/de/, FR=/fr/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locales["DE"] != "/de/" || locales["FR"] != "/fr/" {
+		t.Errorf("locales = %v", locales)
+	}
+	for _, bad := range []string{"de", "de=", "=/de/"} {
+		if _, err := parseLocaleMap(bad); err == nil {
+			t.Errorf("parseLocaleMap(%q) accepted", bad)
+		}
+	}
+}
+
+func TestLocaleRedirect(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := localeRedirect{
+		header:  "CF-IPCountry",
+		locales: map[string]string{"DE": "/de/"},
+		next:    next,
+	}
+	tests := []struct {
+		country, fallback string
+		status            int
+		location          string
+	}{
+		{"de", "", http.StatusFound, "/de/"},
+		{"US", "/en/", http.StatusFound, "/en/"},
+		{"US", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		h.fallback = tt.fallback
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("CF-IPCountry", tt.country)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %d to %q, want %d to %q", tt.country, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+		}
+		if w.Header().Get("Vary") != "CF-IPCountry" {
+			t.Errorf("%s: Vary = %q", tt.country, w.Header().Get("Vary"))
+		}
+	}
+}
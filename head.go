@@ -0,0 +1,28 @@
+package main
+
+import "net/http"
+
+// bodylessWriter drops the response body while keeping its headers.
+type bodylessWriter struct {
+	http.ResponseWriter
+}
+
+func (w bodylessWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// foldHead answers HEAD requests by running next as if for a GET and
+// discarding the body, so the headers (Content-Length, ETag, ...) are
+// exactly those of the GET. Some caching layers rely on that.
+func foldHead(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		get := new(http.Request)
+		*get = *r
+		get.Method = http.MethodGet
+		next.ServeHTTP(bodylessWriter{w}, get)
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFoldHead(t *testing.T) {
+	var method string
+	h := foldHead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		servePage(w, r)
+	}))
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest("GET", "/", nil))
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest("HEAD", "/", nil))
+
+	if method != "GET" {
+		t.Errorf("next saw a %s, want a GET", method)
+	}
+	if head.Body.Len() != 0 {
+		t.Errorf("HEAD sent a %d byte body", head.Body.Len())
+	}
+	for _, name := range []string{"Content-Length", "Content-Type"} {
+		if g, hd := get.Header().Get(name), head.Header().Get(name); g != hd || g == "" {
+			t.Errorf("%s: GET has %q, HEAD has %q", name, g, hd)
+		}
+	}
+}
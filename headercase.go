@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// managedHeaders are written by net/http itself, which only finds them
+// under their canonical names, so they can't be recased.
+var managedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Date":              true,
+	"Transfer-Encoding": true,
+}
+
+// parseHeaderCase parses a comma-separated list of header names as they
+// should be written, e.g. Etag or X-UA-Compatible.
+func parseHeaderCase(value string) (map[string]string, error) {
+	names := map[string]string{}
+	for _, name := range splitList(value) {
+		canonical := http.CanonicalHeaderKey(name)
+		if managedHeaders[canonical] {
+			return nil, fmt.Errorf("%s is written by net/http and can't be recased", canonical)
+		}
+		if strings.ContainsAny(name, " :") {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		names[canonical] = name
+	}
+	return names, nil
+}
+
+// headerCaseWriter moves headers to their configured names just before
+// they are sent.
+type headerCaseWriter struct {
+	http.ResponseWriter
+	names       map[string]string
+	wroteHeader bool
+}
+
+func (w *headerCaseWriter) recase() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.ResponseWriter.Header()
+	for canonical, name := range w.names {
+		if values, ok := h[canonical]; ok && canonical != name {
+			delete(h, canonical)
+			h[name] = values
+		}
+	}
+}
+
+func (w *headerCaseWriter) WriteHeader(status int) {
+	if !interimStatus(status) {
+		w.recase()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerCaseWriter) Write(b []byte) (int, error) {
+	w.recase()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming responses through the writer.
+func (w *headerCaseWriter) Flush() {
+	w.recase()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *headerCaseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// headerCase writes the named headers with exactly the given casing
+// rather than Go's canonical form, for clients that care. HTTP/1.x
+// writes header names as they are, but HTTP/2 always lower-cases them,
+// so this only has an effect on HTTP/1.x.
+func headerCase(names map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headerCaseWriter{ResponseWriter: w, names: names}, r)
+	})
+}
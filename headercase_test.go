@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseHeaderCase(t *testing.T) {
+	names, err := parseHeaderCase("ETag, X-UA-Compatible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names["Etag"] != "ETag" || names["X-Ua-Compatible"] != "X-UA-Compatible" {
+		t.Errorf("got %v", names)
+	}
+	for _, bad := range []string{"Content-Type", "content-length", "X Bad", "X:Bad"} {
+		if _, err := parseHeaderCase(bad); err == nil {
+			t.Errorf("parseHeaderCase(%q) accepted", bad)
+		}
+	}
+}
+
+func TestHeaderCase(t *testing.T) {
+	names, err := parseHeaderCase("ETag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := headerCase(names, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("body"))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if got := w.Header()["ETag"]; len(got) != 1 || got[0] != `"abc"` {
+		t.Errorf("ETag = %v, want it under its configured name", got)
+	}
+	if _, ok := w.Header()["Etag"]; ok {
+		t.Error("the canonical Etag was kept as well")
+	}
+	if w.Header().Get("Cache-Control") != "no-cache" {
+		t.Error("an unconfigured header was lost")
+	}
+}
+
+func TestHeaderCaseAfterInterimResponse(t *testing.T) {
+	names, err := parseHeaderCase("ETag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := headerCase(names, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusContinue)
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	w := &interimRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if _, ok := w.Header()["ETag"]; !ok || w.Code != http.StatusCreated {
+		t.Errorf("final %d response headers %v, want ETag recased", w.Code, w.Header())
+	}
+}
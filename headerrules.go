@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerRule sets a header on responses to paths matching a glob.
+type headerRule struct {
+	glob    string
+	pattern *regexp.Regexp
+	name    string
+	value   string
+}
+
+// headerRulesFlag collects repeated -header flags of the form
+// glob:Header-Name:value, in the order given.
+type headerRulesFlag []headerRule
+
+func (f *headerRulesFlag) String() string {
+	rules := make([]string, len(*f))
+	for i, rule := range *f {
+		rules[i] = rule.glob + ":" + rule.name + ":" + rule.value
+	}
+	return strings.Join(rules, " ")
+}
+
+func (f *headerRulesFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "/") || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("expected /glob:Header-Name:value, got %q", value)
+	}
+	*f = append(*f, headerRule{
+		glob:    parts[0],
+		pattern: globPattern(parts[0]),
+		name:    http.CanonicalHeaderKey(strings.TrimSpace(parts[1])),
+		value:   strings.TrimSpace(parts[2]),
+	})
+	return nil
+}
+
+// globPattern compiles a path glob: * matches within a path segment, **
+// across segments and ? a single character other than /.
+func globPattern(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// headerRulesWriter applies the matching rules just before the headers
+// are sent, so they win over the defaults handlers set.
+type headerRulesWriter struct {
+	http.ResponseWriter
+	rules       []headerRule
+	wroteHeader bool
+}
+
+func (w *headerRulesWriter) apply() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	for _, rule := range w.rules {
+		w.Header().Set(rule.name, rule.value)
+	}
+}
+
+func (w *headerRulesWriter) WriteHeader(status int) {
+	if !interimStatus(status) {
+		w.apply()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerRulesWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming responses through the writer.
+func (w *headerRulesWriter) Flush() {
+	w.apply()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *headerRulesWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// headerRules sets the headers of every rule whose glob matches the
+// request path, in order, so later rules override earlier ones for the
+// same header. They are applied when the response is sent, after the
+// handler's own headers, so they override those too.
+func headerRules(rules headerRulesFlag, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var matched []headerRule
+		for _, rule := range rules {
+			if rule.pattern.MatchString(r.URL.Path) {
+				matched = append(matched, rule)
+			}
+		}
+		if len(matched) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&headerRulesWriter{ResponseWriter: w, rules: matched}, r)
+	})
+}
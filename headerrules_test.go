@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"/*.js", "/app.js", true},
+		{"/*.js", "/static/app.js", false},
+		{"/**.js", "/static/app.js", true},
+		{"/static/**", "/static/a/b.css", true},
+		{"/app.?s", "/app.js", true},
+		{"/app.?s", "/app.s", false},
+		{"/a?b", "/a/b", false},
+		{"/file.(1)", "/file.(1)", true},
+		{"/file.js", "/fileXjs", false},
+	}
+	for _, tt := range tests {
+		if got := globPattern(tt.glob).MatchString(tt.path); got != tt.want {
+			t.Errorf("%s matches %s = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderRulesFlag(t *testing.T) {
+	var f headerRulesFlag
+	if err := f.Set("/fonts/**:access-control-allow-origin: *"); err != nil {
+		t.Fatal(err)
+	}
+	if f[0].name != "Access-Control-Allow-Origin" || f[0].value != "*" {
+		t.Errorf("got %+v", f[0])
+	}
+	for _, bad := range []string{"/x:Header", "x:Header:v", "/x: :v"} {
+		if err := (&headerRulesFlag{}).Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+}
+
+func TestHeaderRules(t *testing.T) {
+	var rules headerRulesFlag
+	for _, value := range []string{
+		"/**:Cache-Control:no-cache",
+		"/static/**:Cache-Control:max-age=3600",
+		"/static/*.js:X-Asset:js",
+	} {
+		if err := rules.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := headerRules(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public")
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		path, cacheControl, asset string
+	}{
+		{"/", "no-cache", ""},
+		{"/static/app.js", "max-age=3600", "js"},
+		{"/static/app.css", "max-age=3600", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("%s: Cache-Control = %q, want %q", tt.path, got, tt.cacheControl)
+		}
+		if got := w.Header().Get("X-Asset"); got != tt.asset {
+			t.Errorf("%s: X-Asset = %q, want %q", tt.path, got, tt.asset)
+		}
+	}
+}
+
+func TestHeaderRulesAfterInterimResponse(t *testing.T) {
+	var rules headerRulesFlag
+	if err := rules.Set("/**:Cache-Control:no-store"); err != nil {
+		t.Fatal(err)
+	}
+	h := headerRules(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusContinue)
+		w.Header().Set("Cache-Control", "public")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	w := &interimRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/upload", nil))
+	if got := w.Header().Get("Cache-Control"); got != "no-store" || w.Code != http.StatusCreated {
+		t.Errorf("final %d response has Cache-Control %q, want the rule's", w.Code, got)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readiness tracks whether the server should be sent new traffic. It is
+// set while serving and cleared once shutdown begins so load balancers
+// drain the instance.
+type readiness struct {
+	ready int32
+	// retryAfter is the Retry-After hint sent while not ready
+	retryAfter time.Duration
+}
+
+func (rd *readiness) set(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&rd.ready, v)
+}
+
+func (rd *readiness) isReady() bool {
+	return atomic.LoadInt32(&rd.ready) == 1
+}
+
+// healthz reports that the process is up.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// ServeHTTP answers readiness checks: 200 while ready, 503 otherwise.
+func (rd *readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !rd.isReady() {
+		serviceUnavailable(w, rd.retryAfter)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
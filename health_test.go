@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	rd := &readiness{retryAfter: 1500 * time.Millisecond}
+	rd.set(true)
+	w := httptest.NewRecorder()
+	rd.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("ready: status = %d, want 200", w.Code)
+	}
+
+	rd.set(false)
+	w = httptest.NewRecorder()
+	rd.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("draining: status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("draining: Retry-After = %q, want 2", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+}
+
+func TestPing(t *testing.T) {
+	captureLog(t)
+	srv := httptest.NewServer(newTestServer(t, "-rootdir", writeTree(t, "index.html")).Handler)
+	defer srv.Close()
+
+	for _, method := range []string{"GET", "HEAD"} {
+		req, _ := http.NewRequest(method, srv.URL+"/ping", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", method, resp.StatusCode)
+		}
+		want := `{"response": "pong"}`
+		if method == "HEAD" {
+			want = ""
+		}
+		if string(body) != want {
+			t.Errorf("%s: body %q, want %q", method, body, want)
+		}
+	}
+}
+
+func TestLBCheckPath(t *testing.T) {
+	captureLog(t)
+	h := newTestServer(t,
+		"-rootdir", writeTree(t, "index.html"),
+		"-lb-check-path", "/lb-check",
+		"-domain", "example.com",
+		"-unknown-host-action", "404",
+	).Handler
+
+	// load balancers check by address, not -domain
+	for _, method := range []string{"GET", "HEAD"} {
+		for _, host := range []string{"example.com", "10.0.0.5:80"} {
+			r := httptest.NewRequest(method, "/lb-check", nil)
+			r.Host = host
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK || w.Body.Len() != 0 {
+				t.Errorf("%s for %s: got %d %q, want an empty 200", method, host, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	// the host check still applies elsewhere
+	r := httptest.NewRequest("GET", "/some/route", nil)
+	r.Host = "10.0.0.5:80"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown host: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runHook runs a lifecycle hook command through the system shell,
+// logging its output.
+func runHook(name, command string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	out, err := cmd.CombinedOutput()
+	if output := strings.TrimSpace(string(out)); output != "" {
+		log.Printf("%s hook: %s\n", name, output)
+	}
+	return err
+}
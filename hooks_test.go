@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestRunHook(t *testing.T) {
+	buf := captureLog(t)
+	if err := runHook("on-start", "echo started"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "on-start hook: started") {
+		t.Errorf("logged %q, want the hook's output", buf.String())
+	}
+	if err := runHook("on-stop", "exit 3"); err == nil {
+		t.Error("expected an error from a failing hook")
+	}
+}
+
+// TestHookDial is not a test of its own: the tests below run the test
+// binary as a hook, which then dials $HOOK_TEST_DIAL and fails if
+// nothing is listening there.
+func TestHookDial(t *testing.T) {
+	addr := os.Getenv("HOOK_TEST_DIAL")
+	if addr == "" {
+		t.Skip("only run as a hook")
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	conn.Close()
+}
+
+func TestStartHookRunsOnceListening(t *testing.T) {
+	captureLog(t)
+	addr := freeAddr(t)
+	certFile, keyFile := writeCert(t, []string{"localhost"}, nil)
+	t.Setenv("HOOK_TEST_DIAL", addr)
+	srv := &http.Server{Addr: addr, Handler: http.NotFoundHandler()}
+	defer srv.Close()
+
+	lc := newLifecycle(&readiness{}, nil, nil)
+	lc.onStart = fmt.Sprintf("%s -test.run='^TestHookDial$'", os.Args[0])
+	if err := lc.start(func() error { return serveTLS(srv, certFile, keyFile, 0) }); err != nil {
+		t.Errorf("start hook couldn't reach the server: %v", err)
+	}
+}
+
+func TestStartHookSkippedIfServeFails(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "started")
+	lc := newLifecycle(&readiness{}, nil, nil)
+	lc.onStart = "touch " + marker
+	if err := lc.start(func() error { return fmt.Errorf("address in use") }); err == nil {
+		t.Error("expected serve's error")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("start hook ran though the server never started")
+	}
+
+	lc.onStart = "exit 1"
+	if err := lc.start(func() error { return nil }); err == nil {
+		t.Error("expected an error from a failing start hook")
+	}
+}
+
+func TestStopHookRunsAfterDrain(t *testing.T) {
+	captureLog(t)
+	events := filepath.Join(t.TempDir(), "events")
+	record := func(event string) {
+		f, err := os.OpenFile(events, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		fmt.Fprintln(f, event)
+		f.Close()
+	}
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		record("request")
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	ready := &readiness{}
+	ready.set(true)
+	lc := newLifecycle(ready, func() *http.Server { return srv }, func(int) {})
+	lc.wait = 5 * time.Second
+	lc.onStop = "echo stop >> " + events
+
+	result := get("http://" + ln.Addr().String())
+	<-started
+	sigs := make(chan os.Signal, 1)
+	sigs <- syscall.SIGTERM
+	if err := lc.Run(sigs); err != nil {
+		t.Fatal(err)
+	}
+	<-result
+	got, _ := ioutil.ReadFile(events)
+	if string(got) != "request\nstop\n" {
+		t.Errorf("events %q, want the stop hook after the in-flight request", got)
+	}
+}
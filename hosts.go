@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// unknownHostActions are the responses -unknown-host-action can choose
+// for requests addressed to a host the server doesn't know.
+var unknownHostActions = map[string]bool{
+	"":         true,
+	"404":      true,
+	"421":      true,
+	"redirect": true,
+}
+
+// checkHost applies action to requests whose Host is not one of known.
+// A redirect goes to the same path on canonical. Requests for the exempt
+// paths, the health checks, are always let through: load balancers and
+// orchestrators usually address instances by IP.
+func checkHost(known, exempt map[string]bool, action, canonical string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if known[requestHost(r)] || exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch action {
+		case "404":
+			http.NotFound(w, r)
+		case "421":
+			http.Error(w, http.StatusText(http.StatusMisdirectedRequest), http.StatusMisdirectedRequest)
+		case "redirect":
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			target := fmt.Sprintf("%s://%s%s", scheme, canonical, r.URL.RequestURI())
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
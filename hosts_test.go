@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHost(t *testing.T) {
+	known := map[string]bool{"example.com": true}
+	exempt := map[string]bool{"/healthz": true, "/lb": true}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		action, host, path string
+		want               int
+		location           string
+	}{
+		{"404", "example.com", "/", http.StatusOK, ""},
+		{"404", "EXAMPLE.com:8080", "/", http.StatusOK, ""},
+		{"404", "10.0.0.7", "/", http.StatusNotFound, ""},
+		{"421", "10.0.0.7", "/app", http.StatusMisdirectedRequest, ""},
+		{"redirect", "www.example.com", "/app?x=1", http.StatusMovedPermanently, "http://example.com/app?x=1"},
+		{"404", "10.0.0.7", "/healthz", http.StatusOK, ""},
+		{"421", "10.0.0.7", "/lb", http.StatusOK, ""},
+		{"redirect", "10.0.0.7", "/healthz", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		h := checkHost(known, exempt, tt.action, "example.com", ok)
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s%s: got %d %q, want %d %q",
+				tt.action, tt.host, tt.path, w.Code, w.Header().Get("Location"), tt.want, tt.location)
+		}
+	}
+}
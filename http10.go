@@ -0,0 +1,16 @@
+package main
+
+import "net/http"
+
+// defaultHost fills in the Host of requests that arrived without one,
+// as HTTP/1.0 clients may, so that host-based routing still applies.
+// There is nothing to do about chunked encoding: net/http never uses it
+// for HTTP/1.0 responses and closes the connection instead.
+func defaultHost(host string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "" {
+			r.Host = host
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultHost(t *testing.T) {
+	var host string
+	h := defaultHost("www.example.com", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Proto, r.ProtoMinor = "HTTP/1.0", 0
+	r.Host = ""
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if host != "www.example.com" {
+		t.Errorf("Host = %q, want the default", host)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Host = "api.example.com"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if host != "api.example.com" {
+		t.Errorf("Host = %q, want the request's own", host)
+	}
+}
+
+func TestHTTP10Responses(t *testing.T) {
+	captureLog(t)
+	root := writeTree(t, "index.html")
+	// large enough that even compressed it outgrows net/http's buffer,
+	// which would otherwise let the server set Content-Length itself
+	var buf bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&buf, "var v%d = %d;\n", i, i*7919%10007)
+	}
+	script := buf.String()
+	if err := ioutil.WriteFile(filepath.Join(root, "app.js"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, "-rootdir", root, "-domain", "www.example.com")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	for _, test := range []struct{ path, encoding string }{
+		{"/", ""},
+		// compressed as it streams, so its length isn't known up front
+		{"/app.js", "gzip"},
+	} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "GET %s HTTP/1.0\r\nAccept-Encoding: %s\r\n\r\n", test.path, test.encoding)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		raw, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+
+		head := string(raw[:bytes.Index(raw, []byte("\r\n\r\n"))])
+		if strings.Contains(strings.ToLower(head), "transfer-encoding") {
+			t.Errorf("%s: chunked response to an HTTP/1.0 client:\n%s", test.path, head)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", test.path, resp.StatusCode)
+		}
+		// without chunking, the body ends at its Content-Length or when
+		// the server closes the connection
+		if resp.ContentLength >= 0 && int64(len(body)) != resp.ContentLength {
+			t.Errorf("%s: %d bytes for Content-Length %d", test.path, len(body), resp.ContentLength)
+		}
+		if resp.ContentLength < 0 && !resp.Close {
+			t.Errorf("%s: no Content-Length and the connection kept open:\n%s", test.path, head)
+		}
+		if test.encoding == "gzip" {
+			if resp.Header.Get("Content-Encoding") != "gzip" {
+				t.Fatalf("%s: not compressed:\n%s", test.path, head)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err = ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%s: truncated body: %v", test.path, err)
+			}
+			if string(body) != script {
+				t.Errorf("%s: body differs from the file", test.path)
+			}
+		} else if string(body) != "index.html" {
+			t.Errorf("%s: body %q, want the index", test.path, body)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build http3
+// +build http3
+
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Supported reports whether the binary can serve HTTP/3.
+const http3Supported = true
+
+// serveHTTP3 serves handler over HTTP/3 on the UDP port of addr, with the
+// TLS config of the TCP server.
+func serveHTTP3(addr string, handler http.Handler, config *tls.Config) http3Server {
+	s := &http3.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: config,
+	}
+	go func() {
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Println("HTTP/3 listener:", err)
+		}
+	}()
+	return s
+}
@@ -0,0 +1,17 @@
+//go:build !http3
+// +build !http3
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// http3Supported reports whether the binary can serve HTTP/3: build with
+// -tags http3 to compile in quic-go.
+const http3Supported = false
+
+func serveHTTP3(addr string, handler http.Handler, config *tls.Config) http3Server {
+	panic("built without HTTP/3 support")
+}
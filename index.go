@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// indexCache holds the contents of the index file in memory so that
+// the SPA fallback, which is hit for almost every client-side route,
+// can be served without going to disk.
+type indexCache struct {
+	path string
+
+	mu      sync.RWMutex
+	body    []byte
+	etag    string
+	modTime time.Time
+}
+
+// newIndexCache reads the file at the given path into memory.
+func newIndexCache(path string) (*indexCache, error) {
+	c := &indexCache{path: path}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load (re-)reads the index file from disk, replacing the cached copy.
+func (c *indexCache) load() error {
+	c.mu.RLock()
+	path := c.path
+	c.mu.RUnlock()
+	return c.loadFrom(path)
+}
+
+// loadFrom reads the index file at a new path, replacing the cached
+// copy.
+func (c *indexCache) loadFrom(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path = path
+	c.body = body
+	c.etag = strongETag(body)
+	c.modTime = info.ModTime()
+	return nil
+}
+
+// file returns the path of the cached index file.
+func (c *indexCache) file() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.path
+}
+
+// ServeHTTP serves the cached index. http.ServeContent takes care of
+// conditional and range requests using the ETag and modification time.
+func (c *indexCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	path, body, etag, modTime := c.path, c.body, c.etag, c.modTime
+	c.mu.RUnlock()
+
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, path, modTime, bytes.NewReader(body))
+}
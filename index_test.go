@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexCache(t *testing.T) {
+	root := writeTree(t, "index.html", "staged/index.html")
+	c, err := newIndexCache(filepath.Join(root, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Body.String() != "index.html" || w.Header().Get("ETag") == "" {
+		t.Fatalf("got %q with ETag %q", w.Body.String(), w.Header().Get("ETag"))
+	}
+
+	r := httptest.NewRequest("GET", "/some/route", nil)
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status = %d, want 304", w.Code)
+	}
+
+	// the copy in memory outlives changes on disk until reloaded
+	if err := ioutil.WriteFile(c.file(), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "index.html" {
+		t.Errorf("before a reload got %q", w.Body.String())
+	}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "new" {
+		t.Errorf("after a reload got %q", w.Body.String())
+	}
+
+	staged := filepath.Join(root, "staged", "index.html")
+	if err := c.loadFrom(staged); err != nil {
+		t.Fatal(err)
+	}
+	if c.file() != staged {
+		t.Errorf("file() = %q, want %q", c.file(), staged)
+	}
+}
+
+// BenchmarkIndexFallback serves a client-side route from the preloaded
+// index and from disk.
+func BenchmarkIndexFallback(b *testing.B) {
+	root := b.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "index.html"), []byte(testPage), 0644); err != nil {
+		b.Fatal(err)
+	}
+	c, err := newIndexCache(filepath.Join(root, "index.html"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	handlers := map[string]spaHandler{
+		"memory": {staticPath: root, indexPath: "index.html", index: c},
+		"disk":   {staticPath: root, indexPath: "index.html"},
+	}
+	for _, name := range []string{"memory", "disk"} {
+		h := handlers[name]
+		b.Run(name, func(b *testing.B) {
+			r := httptest.NewRequest("GET", "/some/route", nil)
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+// inlineCSSPlaceholder marks where in the index -inline-css puts the CSS.
+const inlineCSSPlaceholder = "<!-- inline-css -->"
+
+// linkPattern matches a <link> element.
+var linkPattern = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+
+// inlineCSS returns a transform that puts the CSS file at path into the
+// index in a <style> element, sparing the browser a render-blocking
+// request. The element replaces the placeholder if there is one, else
+// the <link> to href if href is set and linked, else it goes right before
+// </head>.
+func inlineCSS(path, href string) (indexTransform, error) {
+	css, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(bytes.ToLower(css), []byte("</style")) {
+		return nil, fmt.Errorf("%s contains </style", path)
+	}
+	style := []byte("<style>" + string(css) + "</style>")
+	hrefAttr := regexp.MustCompile(`(?i)\bhref\s*=\s*["']?` + regexp.QuoteMeta(href) + `["'\s>]`)
+
+	return func(src []byte) ([]byte, error) {
+		if at := bytes.Index(src, []byte(inlineCSSPlaceholder)); at >= 0 {
+			return splice(src, at, at+len(inlineCSSPlaceholder), style), nil
+		}
+		if href != "" {
+			for _, loc := range linkPattern.FindAllIndex(src, -1) {
+				if hrefAttr.Match(src[loc[0]:loc[1]]) {
+					return splice(src, loc[0], loc[1], style), nil
+				}
+			}
+		}
+		at := bytes.Index(bytes.ToLower(src), []byte("</head>"))
+		if at < 0 {
+			at = 0
+		}
+		return splice(src, at, at, style), nil
+	}, nil
+}
+
+// splice returns src with src[start:end] replaced by insert.
+func splice(src []byte, start, end int, insert []byte) []byte {
+	out := make([]byte, 0, len(src)-(end-start)+len(insert))
+	out = append(out, src[:start]...)
+	out = append(out, insert...)
+	return append(out, src[end:]...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInlineCSS(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "critical.css")
+	if err := ioutil.WriteFile(path, []byte("body{margin:0}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const style = "<style>body{margin:0}</style>"
+	tests := []struct {
+		name, href, src, want string
+	}{
+		{
+			"placeholder", "/app.css",
+			`<head><link rel="stylesheet" href="/app.css"><!-- inline-css --></head>`,
+			`<head><link rel="stylesheet" href="/app.css">` + style + `</head>`,
+		},
+		{
+			"link", "/app.css",
+			`<head><LINK rel="stylesheet" HREF='/app.css'><link href="/other.css"></head>`,
+			`<head>` + style + `<link href="/other.css"></head>`,
+		},
+		{
+			"other link", "/app.css",
+			`<head><link href="/app.css.map"></HEAD>`,
+			`<head><link href="/app.css.map">` + style + `</HEAD>`,
+		},
+		{
+			"no href", "",
+			`<head><link href="/app.css"></head>`,
+			`<head><link href="/app.css">` + style + `</head>`,
+		},
+		{
+			"no head", "",
+			`<body></body>`,
+			style + `<body></body>`,
+		},
+	}
+	for _, tt := range tests {
+		transform, err := inlineCSS(path, tt.href)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := transform([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInlineCSSRejectsStyleEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.css")
+	if err := ioutil.WriteFile(path, []byte("a{}</STYLE><script>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inlineCSS(path, ""); err == nil {
+		t.Error("CSS that closes the <style> element was accepted")
+	}
+	if _, err := inlineCSS(filepath.Join(t.TempDir(), "missing.css"), ""); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ipAllowlist is a set of networks clients may connect from.
+type ipAllowlist []*net.IPNet
+
+// parseIPAllowlist parses a comma-separated list of IP addresses and
+// CIDR networks.
+func parseIPAllowlist(value string) (ipAllowlist, error) {
+	var list ipAllowlist
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+// remoteIP returns the IP address the request came from.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// allows reports whether the request came from an allowed network.
+func (l ipAllowlist) allows(r *http.Request) bool {
+	ip := remoteIP(r)
+	if ip == nil {
+		return false
+	}
+	return l.contains(ip)
+}
+
+// contains reports whether ip is in one of the networks.
+func (l ipAllowlist) contains(ip net.IP) bool {
+	for _, network := range l {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
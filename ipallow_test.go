@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	list, err := parseIPAllowlist("10.0.0.0/8, 192.168.1.5, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"10.1.2.3:5000":    true,
+		"192.168.1.5:5000": true,
+		"192.168.1.6:5000": false,
+		"[::1]:5000":       true,
+		"8.8.8.8:5000":     false,
+		"garbage":          false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		if got := list.allows(r); got != want {
+			t.Errorf("allows(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	for _, bad := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := parseIPAllowlist(bad); err == nil {
+			t.Errorf("parseIPAllowlist(%q) accepted", bad)
+		}
+	}
+}
+
+func TestSourcemapAllowlist(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js", "app.js.map")
+	list, err := parseIPAllowlist("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := spaHandler{staticPath: root, indexPath: "index.html", sourcemaps: list}
+	tests := []struct {
+		addr, path string
+		status     int
+	}{
+		{"10.0.0.1:5000", "/app.js.map", http.StatusOK},
+		{"8.8.8.8:5000", "/app.js.map", http.StatusNotFound},
+		{"8.8.8.8:5000", "/app.js", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.RemoteAddr = tt.addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s from %s: status = %d, want %d", tt.path, tt.addr, w.Code, tt.status)
+		}
+	}
+}
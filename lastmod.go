@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// lastModifiedWriter replaces whatever Last-Modified a handler sets
+// with a fixed value. If notModified is set, a successful response for a
+// file is turned into a 304 on the way out.
+type lastModifiedWriter struct {
+	http.ResponseWriter
+	lastModified string
+	notModified  bool
+	wroteHeader  bool
+	// discard drops the body of a response turned into a 304
+	discard bool
+}
+
+func (w *lastModifiedWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if h.Get("Last-Modified") != "" {
+		h.Set("Last-Modified", w.lastModified)
+		// only files carry a Last-Modified, so anything else, such as
+		// a 404, is left alone
+		if w.notModified && (status == http.StatusOK || status == http.StatusPartialContent) {
+			// as http.ServeContent does for its own 304s
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			h.Del("Content-Encoding")
+			h.Del("Content-Range")
+			status = http.StatusNotModified
+			w.discard = true
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *lastModifiedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// fixedLastModified reports modTime as the Last-Modified time of every
+// response instead of the file's own mtime, so hosts serving the same
+// build agree. If-Modified-Since and If-Range dates are evaluated
+// against modTime too, on a copy of the request so the handler never
+// compares them with the file's own mtime.
+func fixedLastModified(modTime time.Time, next http.Handler) http.Handler {
+	modTime = modTime.UTC().Truncate(time.Second)
+	lastModified := modTime.Format(http.TimeFormat)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ims := r.Header.Get("If-Modified-Since")
+		ir := r.Header.Get("If-Range")
+		dateRange := ir != "" && !strings.HasPrefix(ir, "\"") && !strings.HasPrefix(ir, "W/")
+		if ims == "" && !dateRange {
+			next.ServeHTTP(&lastModifiedWriter{ResponseWriter: w, lastModified: lastModified}, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		lw := &lastModifiedWriter{ResponseWriter: w, lastModified: lastModified}
+		if ims != "" {
+			r.Header.Del("If-Modified-Since")
+			since, err := http.ParseTime(ims)
+			lw.notModified = err == nil && r.Header.Get("If-None-Match") == "" &&
+				(r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+				!modTime.After(since)
+		}
+		if dateRange {
+			// settle it here, keeping the range only if the client's
+			// copy is of this build
+			r.Header.Del("If-Range")
+			if t, err := http.ParseTime(ir); err != nil || !t.Equal(modTime) {
+				r.Header.Del("Range")
+			}
+		}
+		next.ServeHTTP(lw, r)
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixedLastModified(t *testing.T) {
+	build := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	fileTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var seen http.Header
+	h := fixedLastModified(build, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header
+		if r.URL.Path == "/missing.js" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "app.js", fileTime, strings.NewReader("console.log(1)"))
+	}))
+
+	tests := []struct {
+		path, ims string
+		status    int
+	}{
+		{"/app.js", "", http.StatusOK},
+		{"/app.js", build.Format(http.TimeFormat), http.StatusNotModified},
+		{"/app.js", build.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+		{"/missing.js", build.Format(http.TimeFormat), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.ims != "" {
+			r.Header.Set("If-Modified-Since", tt.ims)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s since %q: status = %d, want %d", tt.path, tt.ims, w.Code, tt.status)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() > 0 {
+			t.Errorf("%s: 304 with a body", tt.path)
+		}
+		if r.Header.Get("If-Modified-Since") != tt.ims {
+			t.Errorf("%s: the caller's request was modified", tt.path)
+		}
+		if tt.path == "/app.js" && w.Header().Get("Last-Modified") != build.Format(http.TimeFormat) {
+			t.Errorf("%s: Last-Modified = %q", tt.path, w.Header().Get("Last-Modified"))
+		}
+		if seen.Get("If-Modified-Since") != "" {
+			t.Errorf("%s: the handler saw If-Modified-Since", tt.path)
+		}
+	}
+}
+
+func TestFixedLastModifiedIfRange(t *testing.T) {
+	build := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	h := fixedLastModified(build, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "app.js", time.Now(), strings.NewReader("0123456789"))
+	}))
+	for ir, want := range map[string]int{
+		build.Format(http.TimeFormat):                 http.StatusPartialContent,
+		build.Add(-time.Hour).Format(http.TimeFormat): http.StatusOK,
+	} {
+		r := httptest.NewRequest("GET", "/app.js", nil)
+		r.Header.Set("Range", "bytes=0-3")
+		r.Header.Set("If-Range", ir)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("If-Range %q: status = %d, want %d", ir, w.Code, want)
+		}
+	}
+}
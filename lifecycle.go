@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// lifecycle runs the start hook once the server is listening and takes
+// the server from its first stop signal to a full stop: it fails
+// readiness checks, drains the servers, then runs the stop hook. A
+// second signal while draining closes the live server at once and
+// exits.
+type lifecycle struct {
+	ready *readiness
+	// readyDelay is how long load balancers get to notice the failing
+	// readiness checks before the drain starts
+	readyDelay time.Duration
+	// wait is how long in-flight requests get to finish
+	wait time.Duration
+	// live marks shutdown as begun and returns the server to drain
+	live func() *http.Server
+	// others are drained alongside the live server, such as the plain
+	// HTTP and HTTP/3 listeners
+	others []interface {
+		Shutdown(ctx context.Context) error
+	}
+	onStart, onStop string
+	// exit ends the process, os.Exit outside of tests
+	exit func(code int)
+	done chan struct{}
+}
+
+func newLifecycle(ready *readiness, live func() *http.Server, exit func(code int)) *lifecycle {
+	return &lifecycle{ready: ready, live: live, exit: exit, done: make(chan struct{})}
+}
+
+// Done returns a channel that is closed once Run has returned, with the
+// servers drained and the stop hook run, for code that has to wait for
+// a full stop.
+func (l *lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// start calls serve, which must return once the server is listening,
+// then runs the start hook, so that the hook finds the server reachable.
+func (l *lifecycle) start(serve func() error) error {
+	if err := serve(); err != nil {
+		return err
+	}
+	if l.onStart != "" {
+		if err := runHook("start", l.onStart); err != nil {
+			return fmt.Errorf("start hook failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// Run blocks until a signal arrives on sigs, then shuts down gracefully,
+// returning the live server's Shutdown error.
+func (l *lifecycle) Run(sigs <-chan os.Signal) error {
+	defer close(l.done)
+	<-sigs
+	current := l.live()
+
+	// a second signal while draining skips the graceful shutdown
+	drained := make(chan struct{})
+	defer close(drained)
+	go func() {
+		select {
+		case <-sigs:
+			log.Println("Forcing shutdown...")
+			current.Close()
+			l.exit(1)
+		case <-drained:
+		}
+	}()
+
+	// fail readiness checks first so load balancers stop sending traffic,
+	// give them -ready-delay to notice, then let in-flight requests have
+	// up to -wait to finish
+	l.ready.set(false)
+	if l.readyDelay > 0 {
+		log.Println("Draining for", l.readyDelay)
+		time.Sleep(l.readyDelay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.wait)
+	defer cancel()
+
+	for _, srv := range l.others {
+		srv.Shutdown(ctx)
+	}
+	err := current.Shutdown(ctx)
+
+	log.Println("Shutting down...")
+	if l.onStop != "" {
+		if err := runHook("stop", l.onStop); err != nil {
+			log.Println("Stop hook failed:", err)
+		}
+	}
+	return err
+}
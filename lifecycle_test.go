@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blockingServer starts a server whose requests wait for release, and
+// sends on started as each one arrives.
+func blockingServer(t *testing.T, release <-chan struct{}) (*http.Server, string, <-chan struct{}) {
+	t.Helper()
+	started := make(chan struct{}, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("done"))
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return srv, "http://" + ln.Addr().String(), started
+}
+
+// get requests url in the background, sending the error, if any, on
+// the returned channel once the response has been read.
+func get(url string) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	return result
+}
+
+func TestLifecycleDrains(t *testing.T) {
+	captureLog(t)
+	release := make(chan struct{})
+	srv, url, started := blockingServer(t, release)
+	ready := &readiness{}
+	ready.set(true)
+	exited := make(chan int, 1)
+	lc := newLifecycle(ready, func() *http.Server { return srv }, func(code int) { exited <- code })
+	lc.wait = 5 * time.Second
+
+	result := get(url)
+	<-started
+	sigs := make(chan os.Signal, 1)
+	sigs <- syscall.SIGTERM
+	done := make(chan error, 1)
+	go func() { done <- lc.Run(sigs) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if ready.isReady() {
+		t.Error("still ready while draining")
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v", err)
+	}
+	select {
+	case code := <-exited:
+		t.Errorf("exited with %d after a single signal", code)
+	default:
+	}
+}
+
+func TestLifecycleSecondSignalForcesExit(t *testing.T) {
+	captureLog(t)
+	release := make(chan struct{})
+	defer close(release)
+	srv, url, started := blockingServer(t, release)
+	ready := &readiness{}
+	ready.set(true)
+	exited := make(chan int, 1)
+	lc := newLifecycle(ready, func() *http.Server { return srv }, func(code int) { exited <- code })
+	lc.wait = time.Minute
+
+	result := get(url)
+	<-started
+	sigs := make(chan os.Signal, 1)
+	sigs <- syscall.SIGINT
+	done := make(chan error, 1)
+	go func() { done <- lc.Run(sigs) }()
+	for ready.isReady() {
+		time.Sleep(time.Millisecond)
+	}
+
+	sigs <- syscall.SIGINT
+	select {
+	case code := <-exited:
+		if code != 1 {
+			t.Errorf("exit code %d, want 1", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a second signal did not force an exit")
+	}
+	if err := <-result; err == nil {
+		t.Error("the in-flight request was answered, want its connection closed")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Run still draining after the forced exit")
+	}
+}
+
+func TestLifecycleDone(t *testing.T) {
+	captureLog(t)
+	release := make(chan struct{})
+	srv, url, started := blockingServer(t, release)
+	ready := &readiness{}
+	ready.set(true)
+	lc := newLifecycle(ready, func() *http.Server { return srv }, func(int) {})
+	lc.wait = 5 * time.Second
+
+	result := get(url)
+	<-started
+	sigs := make(chan os.Signal, 1)
+	returned := make(chan struct{})
+	go func() {
+		lc.Run(sigs)
+		close(returned)
+	}()
+	select {
+	case <-lc.Done():
+		t.Fatal("Done closed before a stop signal")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	sigs <- syscall.SIGTERM
+	select {
+	case <-lc.Done():
+		t.Fatal("Done closed with a request still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-result
+	select {
+	case <-lc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed after the drain")
+	}
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Error("Done closed before Run returned")
+	}
+}
@@ -1,22 +1,29 @@
 package main
 
 import (
-	"context"
+	"bytes"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/foomo/simplecert"
 	"github.com/foomo/tlsconfig"
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 )
 
 // spaHandler implements the http.Handler interface, so we can use it
@@ -26,6 +33,88 @@ import (
 type spaHandler struct {
 	staticPath string
 	indexPath  string
+	// altIndexes are tried in order when indexPath doesn't exist
+	altIndexes []string
+	// index, if set, serves the fallback from memory instead of disk
+	index *indexCache
+	// files, if set, serves static files from memory instead of disk
+	files *fileCache
+	// hideIndex redirects direct requests for the index file to its
+	// directory so the SPA is only reachable through its clean URLs
+	hideIndex bool
+	// markdownPrefix, if set, is the URL prefix under which .md files
+	// are rendered to HTML
+	markdownPrefix string
+	// timingAllowOrigin, if set, is sent as Timing-Allow-Origin on
+	// static assets so cross-origin pages can read their timings
+	timingAllowOrigin string
+	// nosniff forbids content sniffing and always declares a type
+	nosniff bool
+	// staged, if set, overrides staticPath with a directory that can
+	// be swapped at runtime
+	staged *stagedRoot
+	// dev makes missing assets 404 loudly instead of falling back
+	dev bool
+	// isolate sends the cross-origin isolation headers that features
+	// like SharedArrayBuffer require
+	isolate bool
+	// noFollowSymlinks refuses to serve files whose real location is
+	// outside of the static dir
+	noFollowSymlinks bool
+	// openFiles, if set, is a semaphore bounding how many files are
+	// open for serving at once; requests wait up to openWait for a slot
+	openFiles  chan struct{}
+	openWait   time.Duration
+	retryAfter time.Duration
+	// gzipped, if set, holds precompressed copies of text assets
+	gzipped gzipStore
+	// apiPrefix, if set, is a path prefix whose misses get a JSON 404
+	// instead of the SPA shell
+	apiPrefix string
+	// precompressed serves file.br or file.gz siblings when present
+	precompressed bool
+	// sourcemaps, if set, are the only networks .map files are served to
+	sourcemaps ipAllowlist
+	// assetPattern matches fingerprinted file names, which are cached for
+	// staticMaxAge
+	assetPattern *regexp.Regexp
+	staticMaxAge time.Duration
+	// fallbackExclude lists path prefixes whose misses get a plain 404
+	// instead of the SPA shell
+	fallbackExclude []string
+	// debugServedFile reports the file behind each response in an
+	// X-Served-File header; for development only
+	debugServedFile bool
+	// generated, if set, is served when there is no index file on disk
+	generated *generatedIndex
+	// render, if set, rewrites the index as it is served, to inject
+	// environment variables or version asset URLs
+	render *indexRenderer
+	// fsys, if set, is served instead of the static directory, as when
+	// the assets are embedded in the binary
+	fsys http.FileSystem
+	// etags, if set, caches ETags for the index when served from disk
+	etags *etagCache
+	// allowExt, if set, lists the only file extensions that are served
+	allowExt map[string]bool
+	// notFoundFile, if set, is the body of 404s for fallbackExclude misses
+	notFoundFile string
+}
+
+// hidden reports whether the file at URL path p is kept from the client
+// making r: the index itself under -hide-index, source maps for clients
+// not on the allowlist and extensions outside -allow-ext.
+func (h spaHandler) hidden(r *http.Request, p string) bool {
+	if h.hideIndex && p == "/"+h.indexPath {
+		return true
+	}
+	if h.sourcemaps != nil && strings.HasSuffix(p, ".map") && !h.sourcemaps.allows(r) {
+		return true
+	}
+	if ext := strings.ToLower(path.Ext(p)); h.allowExt != nil && ext != "" && !h.allowExt[ext] {
+		return true
+	}
+	return false
 }
 
 // ServeHTTP inspects the URL path to locate a file within the static dir
@@ -33,23 +122,54 @@ type spaHandler struct {
 // file located at the index path on the SPA handler will be served. This
 // is suitable behavior for serving an SPA (single page application).
 func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// get the absolute path to prevent directory traversal
-	path, err := filepath.Abs(r.URL.Path)
-	if err != nil {
-		// if we failed to get the absolute path respond with a 400 bad request
-		// and stop
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if h.nosniff {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+
+	if h.hideIndex && r.URL.Path == "/"+h.indexPath {
+		// as http.FileServer does for index.html; the relative target
+		// keeps any base path
+		target := "./"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusMovedPermanently)
 		return
 	}
 
-	// prepend the path with the path to the static directory
-	path = filepath.Join(h.staticPath, path)
+	if h.hidden(r, r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if h.openFiles != nil {
+		if !h.acquireFile(r) {
+			serviceUnavailable(w, h.retryAfter)
+			return
+		}
+		defer func() { <-h.openFiles }()
+	}
+
+	if h.fsys != nil {
+		h.serveFS(w, r)
+		return
+	}
+
+	// clean the URL path and prepend the path to the static directory,
+	// refusing anything that would end up outside of it (such as
+	// backslash-separated ".." segments on Windows)
+	staticPath := h.root()
+	path, ok := resolveWithin(staticPath, r.URL.Path)
+	if !ok {
+		badRequest(w, r, "invalid_path", "invalid path")
+		return
+	}
 
 	// check whether a file exists at the given path
-	_, err = os.Stat(path)
+	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
-		// file does not exist, serve index.html
-		http.ServeFile(w, r, filepath.Join(h.staticPath, h.indexPath))
+		h.serveMissing(w, r, path)
 		return
 	} else if err != nil {
 		// if we got an error (that wasn't that the file doesn't exist) stating the
@@ -58,8 +178,307 @@ func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// otherwise, use http.FileServer to serve the static dir
-	http.FileServer(http.Dir(h.staticPath)).ServeHTTP(w, r)
+	// http.FileServer answers a directory with its index.html, so that
+	// is the file to check
+	if h.escapes(path) || (info.IsDir() && h.escapes(filepath.Join(path, "index.html"))) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if h.generated != nil && path == filepath.Clean(staticPath) {
+		// without an index of its own the root would be a listing
+		if _, err := os.Stat(findIndex(staticPath, h.indexPath, h.altIndexes)); os.IsNotExist(err) {
+			h.serveIndex(w, r)
+			return
+		}
+	}
+
+	if h.debugServedFile {
+		served := path
+		if info.IsDir() {
+			// http.FileServer serves a directory's index.html
+			served = filepath.Join(path, "index.html")
+		}
+		h.setServedFile(w.Header(), served)
+	}
+
+	h.setStaticHeaders(w.Header(), path, info.IsDir(), path == filepath.Join(staticPath, h.indexPath))
+	if h.render != nil {
+		// direct requests for the index, including / which http.FileServer
+		// would answer with the root's index.html
+		root := filepath.Clean(staticPath)
+		indexFile := filepath.Join(root, h.indexPath)
+		if path == root {
+			indexFile = filepath.Join(root, "index.html")
+		}
+		if path == root || path == indexFile {
+			if _, err := os.Stat(indexFile); err == nil {
+				h.render.serve(w, r, indexFile)
+				return
+			}
+		}
+	}
+	if h.etags != nil && (path == filepath.Join(staticPath, h.indexPath) || path == filepath.Clean(staticPath)) {
+		// the shell, requested directly; http.FileServer serves / from
+		// the root's index.html
+		indexFile := path
+		if info.IsDir() {
+			indexFile = filepath.Join(path, "index.html")
+		}
+		if indexInfo, err := os.Stat(indexFile); err == nil && !indexInfo.IsDir() {
+			open := func() (io.ReadCloser, error) { return os.Open(indexFile) }
+			if etag, err := h.etags.etag(indexFile, indexInfo, open); err == nil {
+				w.Header().Set("ETag", etag)
+			}
+		}
+	}
+
+	if h.markdownPrefix != "" && !info.IsDir() && isMarkdown(path) &&
+		hasPathPrefix(r.URL.Path, h.markdownPrefix) {
+		serveMarkdown(w, r, path, info.ModTime())
+		return
+	}
+
+	if h.nosniff && !info.IsDir() {
+		setDeclaredType(w.Header(), path)
+	}
+
+	if h.precompressed && !info.IsDir() && servePrecompressed(w, r, path, h.escapes) {
+		return
+	}
+	if h.gzipped != nil && !info.IsDir() && h.gzipped.serve(w, r, path, info) {
+		return
+	}
+
+	// serve regular files from the in-memory cache if enabled
+	if h.files != nil && !info.IsDir() {
+		f, err := h.files.get(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, path, f.modTime, bytes.NewReader(f.body))
+		return
+	}
+
+	// otherwise, use http.FileServer to serve the static dir. http.Dir
+	// hands it *os.File values, which keeps the io.ReaderFrom (sendfile)
+	// fast path for large files; avoid wrapping them in other readers.
+	http.FileServer(http.Dir(staticPath)).ServeHTTP(w, r)
+}
+
+// serveMissing answers a request for a file that doesn't exist, usually
+// with the index. path is where the file was looked for.
+func (h spaHandler) serveMissing(w http.ResponseWriter, r *http.Request, path string) {
+	if h.dev && isAsset(path) {
+		// in development a missing asset is almost always a build
+		// problem, so don't hide it behind the SPA shell
+		log.Printf("dev: asset not found: %s (looked for %s)\n", r.URL.Path, path)
+		http.Error(w, fmt.Sprintf("asset not found: %s (looked for %s)", r.URL.Path, path), http.StatusNotFound)
+		return
+	}
+	if h.apiPrefix != "" && hasPathPrefix(r.URL.Path, h.apiPrefix) {
+		writeJSONError(w, http.StatusNotFound, jsonError{Error: "not found", Path: r.URL.Path})
+		return
+	}
+	for _, prefix := range h.fallbackExclude {
+		if hasPathPrefix(r.URL.Path, prefix) {
+			h.notFound(w, r)
+			return
+		}
+	}
+	// file does not exist, serve index.html
+	if h.isolate {
+		setIsolationHeaders(w.Header(), h.indexPath)
+	}
+	h.serveIndex(w, r)
+}
+
+// notFound responds with a 404, using notFoundFile as the body if it is
+// set and readable.
+func (h spaHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	if h.notFoundFile == "" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadFile(h.notFoundFile)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	typ := mime.TypeByExtension(filepath.Ext(h.notFoundFile))
+	if typ == "" {
+		typ = http.DetectContentType(body)
+	}
+	w.Header().Set("Content-Type", typ)
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// setStaticHeaders sets the headers that depend on which file is being
+// served: font, isolation, caching and timing headers.
+func (h spaHandler) setStaticHeaders(header http.Header, path string, isDir, isIndex bool) {
+	if isFont(path) {
+		setFontHeaders(header)
+	}
+	if h.isolate {
+		setIsolationHeaders(header, path)
+	}
+	if h.assetPattern != nil && !isDir && h.assetPattern.MatchString(filepath.Base(path)) {
+		setImmutableHeaders(header, h.staticMaxAge)
+	} else if isDir || isIndex {
+		setNoCacheHeaders(header)
+	}
+	if h.timingAllowOrigin != "" {
+		header.Set("Timing-Allow-Origin", h.timingAllowOrigin)
+	}
+}
+
+// acquireFile takes a slot from the open files semaphore, giving up
+// after openWait or when the client goes away.
+func (h spaHandler) acquireFile(r *http.Request) bool {
+	select {
+	case h.openFiles <- struct{}{}:
+		return true
+	default:
+	}
+	timer := time.NewTimer(h.openWait)
+	defer timer.Stop()
+	select {
+	case h.openFiles <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// root returns the directory currently being served.
+func (h spaHandler) root() string {
+	if h.staged != nil {
+		return h.staged.dir()
+	}
+	return h.staticPath
+}
+
+// serveIndex serves the index file, from memory if it was preloaded.
+func (h spaHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w.Header())
+	if h.fsys != nil {
+		h.serveIndexFS(w, r)
+		return
+	}
+	if h.noFollowSymlinks {
+		file := findIndex(h.root(), h.indexPath, h.altIndexes)
+		if h.index != nil {
+			file = h.index.file()
+		}
+		if h.escapes(file) {
+			log.Printf("index %s resolves outside of the root\n", file)
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if h.index != nil {
+		if h.debugServedFile {
+			h.setServedFile(w.Header(), h.index.file())
+		}
+		if h.render != nil && h.render.rewrites() {
+			h.render.serve(w, r, h.index.file())
+			return
+		}
+		h.index.ServeHTTP(w, r)
+		return
+	}
+	path := findIndex(h.root(), h.indexPath, h.altIndexes)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && h.generated != nil {
+		h.generated.ServeHTTP(w, r)
+		return
+	}
+	if h.debugServedFile {
+		h.setServedFile(w.Header(), path)
+	}
+	// http.ServeFile would answer with a directory listing or redirect,
+	// which hides what is really a broken build
+	if err == nil && info.IsDir() {
+		log.Printf("index %s is a directory\n", path)
+		http.Error(w, fmt.Sprintf("index %s is a directory, not a file", h.indexPath), http.StatusInternalServerError)
+		return
+	}
+	if h.render != nil {
+		h.render.serve(w, r, path)
+		return
+	}
+	if h.etags != nil && err == nil {
+		// so browsers revalidate the shell rather than download it again
+		etag, err := h.etags.etag(path, info, func() (io.ReadCloser, error) { return os.Open(path) })
+		if err == nil {
+			w.Header().Set("ETag", etag)
+		}
+	}
+	http.ServeFile(w, r, path)
+}
+
+// escapes reports whether serving file would follow a symlink out of the
+// root when that is forbidden. Files that don't exist don't escape.
+func (h spaHandler) escapes(file string) bool {
+	if !h.noFollowSymlinks {
+		return false
+	}
+	if _, err := os.Lstat(file); err != nil {
+		return false
+	}
+	return !resolvesWithin(h.root(), file)
+}
+
+// setServedFile sets X-Served-File to path relative to the root being
+// served.
+func (h spaHandler) setServedFile(header http.Header, path string) {
+	if rel, err := filepath.Rel(h.root(), path); err == nil {
+		path = rel
+	}
+	header.Set("X-Served-File", filepath.ToSlash(path))
+}
+
+// findIndex returns the path of the primary index file in root, or if
+// that doesn't exist, of the first of the alternatives that does.
+func findIndex(root, primary string, alternatives []string) string {
+	path := filepath.Join(root, primary)
+	if len(alternatives) == 0 {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	for _, name := range alternatives {
+		alt := filepath.Join(root, name)
+		if _, err := os.Stat(alt); err == nil {
+			return alt
+		}
+	}
+	return path
+}
+
+// setRetryAfter sets a Retry-After header telling clients to come back
+// after d, rounded up to whole seconds. It does nothing if d isn't
+// positive.
+func setRetryAfter(h http.Header, d time.Duration) {
+	if d > 0 {
+		secs := int64((d + time.Second - 1) / time.Second)
+		h.Set("Retry-After", strconv.FormatInt(secs, 10))
+	}
+}
+
+// serviceUnavailable responds with a 503. If retryAfter is positive, a
+// Retry-After header tells clients when to come back. Every 503 the
+// server generates should go through here so the hint is consistent.
+func serviceUnavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	setRetryAfter(w.Header(), retryAfter)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 }
 
 // CmdLineArgs is a struct containing
@@ -73,86 +492,976 @@ type CmdLineArgs struct {
 	SSL       bool
 	CertCache string
 	SSLEmail  string
+	TLSCert   string
+	TLSKey    string
+
+	PreloadIndex  bool
+	RetryAfter    time.Duration
+	CacheFiles    bool
+	CacheTTL      time.Duration
+	HideIndex     bool
+	CSPReport     string
+	CSPReportURI  string
+	MarkdownDir   string
+	TimingOrigin  string
+	ProxyHosts    hostProxyFlag
+	ProxyCache    time.Duration
+	ProxyRandom   bool
+	ProxyCool     time.Duration
+	ProxyForward  string
+	ProxyGzip     bool
+	ProxyRetries  int
+	ProxyBackoff  time.Duration
+	BreakerLimit  int
+	BreakerSpan   time.Duration
+	BreakerCool   time.Duration
+	ProxyExpect   time.Duration
+	DebugBodies   bool
+	DebugSample   float64
+	DebugLimit    int
+	DebugRedact   string
+	LBCheckPath   string
+	ZipDownloads  bool
+	NoSniff       bool
+	RootRedirect  string
+	HeadAsGet     bool
+	StagingDir    string
+	CopyBuffer    int
+	AppConfig     appConfigFlag
+	AppConfigURL  string
+	StrictPaths   bool
+	DefaultHost   string
+	Dev           bool
+	Isolate       bool
+	NoSymlinks    bool
+	MaxActive     int
+	QueueSize     int
+	RenewCheck    time.Duration
+	UpgradeOnly   bool
+	MaxOpenFiles  int
+	OpenWait      time.Duration
+	LogErrors     bool
+	LogFormat     string
+	UnknownHost   string
+	PreGzip       bool
+	OnStart       string
+	OnStop        string
+	NoRanges      string
+	Stats         bool
+	AdminToken    string
+	BuildTime     string
+	IndexChain    string
+	GeoLocales    string
+	GeoHeader     string
+	MaxHandshakes int
+	APIPrefix     string
+	Precompressed bool
+	Gzip          bool
+	GzipMinBytes  int
+	CompressExt   string
+	SourceMapIPs  string
+	Bandwidth     int
+	AssetPattern  string
+	StaticMaxAge  time.Duration
+	NoFallback    string
+	DebugServed   bool
+	BasePath      string
+	GenIndex      bool
+	AppTitle      string
+	AppRootID     string
+	EnvInject     bool
+	EnvPrefix     string
+	AllowExt      string
+	CORSOrigins   string
+	CORSMethods   string
+	CORSHeaders   string
+	CORSCreds     bool
+	ProxyRewrite  pathRewriteFlag
+	RedirectHTTP  bool
+	HTTPPort      int
+	LogTotals     bool
+	NotFoundFile  string
+	SecHeaders    bool
+	CSP           string
+	HSTS          bool
+	UnixSocket    string
+	UnixMode      string
+	TicketKeys    string
+	TicketRotate  time.Duration
+	ConfigFile    string
+	ProxyErrPage  string
+	CompressCPU   float64
+	RateLimit     float64
+	RateBurst     int
+	TrustedProxy  string
+	BustAssets    string
+	ProxyPaths    pathProxyFlag
+	HTTP2         bool
+	HTTP3         bool
+	HeaderCase    string
+	HeaderRules   headerRulesFlag
+	InlineCSS     string
+	InlineCSSHref string
+	NoCacheIndex  bool
+	ReadyDelay    time.Duration
+	StrictCert    bool
+	GzipLength    bool
+	WatchConfig   bool
 }
 
 func parseArgs() CmdLineArgs {
-	var args CmdLineArgs
-	flag.IntVar(
+	args, err := parseArgsFrom(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	return args
+}
+
+// parseArgsFrom defines the flags on fs and parses arguments with them,
+// then applies the config file and SPA_* environment variables.
+func parseArgsFrom(fs *flag.FlagSet, arguments []string) (CmdLineArgs, error) {
+	args := CmdLineArgs{
+		ProxyHosts:   hostProxyFlag{},
+		AppConfig:    appConfigFlag{},
+		ProxyRewrite: pathRewriteFlag{},
+		ProxyPaths:   pathProxyFlag{},
+	}
+	fs.IntVar(
 		&args.Port,
 		"port",
 		5000,
 		"Specify the port this app should listen on for requests",
 	)
-	flag.StringVar(
+	fs.StringVar(
+		&args.UnixSocket,
+		"unix-socket",
+		"",
+		"Path of a Unix domain socket to listen on instead of -host and -port",
+	)
+	fs.StringVar(
+		&args.UnixMode,
+		"unix-socket-mode",
+		"0660",
+		"Permissions, in octal, of the -unix-socket file",
+	)
+	fs.StringVar(
 		&args.Host,
 		"host",
 		"0.0.0.0",
 		"Specify the host of this service",
 	)
-	flag.StringVar(
+	fs.StringVar(
 		&args.RootDir,
 		"rootdir",
 		"./",
 		"The folder where we should serve the SPA, usually where index.html is located",
 	)
-	flag.DurationVar(
+	fs.DurationVar(
 		&args.Wait,
 		"graceful-timeout",
 		time.Second*15,
 		"The duration for which the server should gracefully wait for existing connections to finish",
 	)
-	flag.StringVar(
+	fs.DurationVar(
+		&args.ReadyDelay,
+		"ready-delay",
+		0,
+		"How long /readyz fails before shutdown starts, so load balancers stop sending traffic first",
+	)
+	fs.StringVar(
 		&args.Domain,
 		"domain",
 		"",
 		"The public domain name of the site",
 	)
-	flag.BoolVar(
+	fs.BoolVar(
 		&args.SSL,
 		"ssl",
 		false,
 		"Run in SSL mode?",
 	)
-	flag.StringVar(
+	fs.StringVar(
 		&args.CertCache,
 		"certcache",
 		"",
 		"Path to the certificate cache (e.g. letsencrypt/live/mysite.com/)",
 	)
-	flag.StringVar(
+	fs.StringVar(
 		&args.SSLEmail,
 		"sslemail",
 		"",
 		"SSL email address",
 	)
-	flag.Parse()
-	return args
+	fs.StringVar(
+		&args.TLSCert,
+		"tls-cert",
+		"",
+		"Path to a PEM certificate to serve TLS with instead of obtaining one from Let's Encrypt",
+	)
+	fs.StringVar(
+		&args.TLSKey,
+		"tls-key",
+		"",
+		"Path to the PEM private key for -tls-cert",
+	)
+	fs.BoolVar(
+		&args.StrictCert,
+		"strict-cert",
+		false,
+		"Refuse to start if -tls-cert isn't valid for -domain (or -host), rather than warn",
+	)
+	fs.StringVar(
+		&args.TicketKeys,
+		"tls-ticket-keys",
+		"",
+		"File of hex-encoded 32 byte TLS session ticket keys, newest first, shared between instances (re-read on SIGHUP)",
+	)
+	fs.Var(
+		&args.HeaderRules,
+		"header",
+		"Set a response header on paths matching a glob (* within a segment, ** across), as /glob:Header-Name:value (repeatable; later rules win)",
+	)
+	fs.StringVar(
+		&args.HeaderCase,
+		"header-case",
+		"",
+		"Comma-separated header names (e.g. Etag,X-UA-Compatible) to send with exactly that casing over HTTP/1.x",
+	)
+	fs.BoolVar(
+		&args.HTTP2,
+		"http2",
+		true,
+		"Offer HTTP/2 to clients when serving TLS",
+	)
+	fs.BoolVar(
+		&args.HTTP3,
+		"http3",
+		false,
+		"Also serve HTTP/3 on the same UDP port when serving TLS, advertised with Alt-Svc (needs a binary built with -tags http3)",
+	)
+	fs.DurationVar(
+		&args.TicketRotate,
+		"tls-ticket-rotate",
+		0,
+		"How often to rotate TLS session ticket keys, re-reading -tls-ticket-keys if set (0 to not rotate)",
+	)
+	fs.BoolVar(
+		&args.NoCacheIndex,
+		"no-cache-index",
+		false,
+		"Read the index from disk for every request instead of keeping it in memory until its mtime changes",
+	)
+	fs.BoolVar(
+		&args.PreloadIndex,
+		"preload-index",
+		false,
+		"Read index.html into memory at startup and serve the fallback from there (reloaded on SIGHUP)",
+	)
+	fs.DurationVar(
+		&args.RetryAfter,
+		"retry-after",
+		time.Second*5,
+		"The Retry-After hint sent with 503 responses and with 502s when no proxy backend is reachable (0 to omit)",
+	)
+	fs.BoolVar(
+		&args.CacheFiles,
+		"cache-files",
+		false,
+		"Keep served static files in memory",
+	)
+	fs.DurationVar(
+		&args.CacheTTL,
+		"cache-ttl",
+		0,
+		"How long a cached file is served before it is re-read from disk (0 for forever)",
+	)
+	fs.BoolVar(
+		&args.HideIndex,
+		"hide-index",
+		false,
+		"Redirect direct requests for /index.html to / with a 301",
+	)
+	fs.StringVar(
+		&args.CSPReport,
+		"csp-report-only",
+		"",
+		"A Content-Security-Policy to send in report-only mode",
+	)
+	fs.BoolVar(
+		&args.SecHeaders,
+		"security-headers",
+		true,
+		"Send X-Content-Type-Options, Referrer-Policy and X-Frame-Options headers with every response",
+	)
+	fs.StringVar(
+		&args.CSP,
+		"csp",
+		"",
+		"A Content-Security-Policy to enforce (sent with -security-headers)",
+	)
+	fs.BoolVar(
+		&args.HSTS,
+		"hsts",
+		false,
+		"Send Strict-Transport-Security when serving TLS (sent with -security-headers)",
+	)
+	fs.StringVar(
+		&args.CSPReportURI,
+		"csp-report-uri",
+		"",
+		"Path at which to accept and log CSP violation reports (e.g. /csp-report)",
+	)
+	fs.StringVar(
+		&args.MarkdownDir,
+		"markdown-dir",
+		"",
+		"URL prefix (e.g. /docs) under which .md files are rendered as HTML",
+	)
+	fs.StringVar(
+		&args.TimingOrigin,
+		"timing-allow-origin",
+		"",
+		"Value of the Timing-Allow-Origin header sent with static assets (e.g. *)",
+	)
+	fs.Var(
+		args.ProxyHosts,
+		"proxy-host",
+		"Proxy all requests for a host to backends, as host=upstream[,upstream...] (repeatable)",
+	)
+	fs.Var(
+		args.ProxyPaths,
+		"proxy",
+		"Proxy requests under a path prefix to backends, as /prefix=upstream[,upstream...] (repeatable)",
+	)
+	fs.Var(
+		args.ProxyRewrite,
+		"proxy-rewrite",
+		"Rewrite a path prefix before proxying, as /public=/backend (repeatable)",
+	)
+	fs.StringVar(
+		&args.ProxyErrPage,
+		"proxy-error-page",
+		"",
+		"HTML file served in place of the body of 5xx responses from proxy upstreams, keeping their status",
+	)
+	fs.BoolVar(
+		&args.ProxyRandom,
+		"proxy-random",
+		false,
+		"Pick proxy upstreams at random instead of round-robin",
+	)
+	fs.DurationVar(
+		&args.ProxyCool,
+		"proxy-cooldown",
+		time.Second*10,
+		"How long a proxy upstream that failed to connect is skipped for",
+	)
+	fs.StringVar(
+		&args.ProxyForward,
+		"proxy-forward-headers",
+		"X-Request-ID,traceparent",
+		"Comma-separated correlation headers always forwarded to proxy upstreams",
+	)
+	fs.BoolVar(
+		&args.ProxyGzip,
+		"proxy-gzip-json",
+		false,
+		"Gzip uncompressed JSON responses from proxy upstreams for clients that accept it",
+	)
+	fs.IntVar(
+		&args.ProxyRetries,
+		"proxy-retries",
+		0,
+		"How many times to retry idempotent proxy requests that fail to connect",
+	)
+	fs.DurationVar(
+		&args.ProxyBackoff,
+		"proxy-retry-backoff",
+		time.Millisecond*100,
+		"How long to wait before retrying a failed proxy request",
+	)
+	fs.IntVar(
+		&args.BreakerLimit,
+		"proxy-breaker-threshold",
+		0,
+		"Number of proxy failures within -proxy-breaker-window that opens the circuit (0 to disable)",
+	)
+	fs.DurationVar(
+		&args.BreakerSpan,
+		"proxy-breaker-window",
+		time.Second*10,
+		"Window in which proxy failures are counted towards the breaker threshold",
+	)
+	fs.DurationVar(
+		&args.BreakerCool,
+		"proxy-breaker-cooldown",
+		time.Second*30,
+		"How long an open circuit fails proxy requests fast before probing the backend",
+	)
+	fs.DurationVar(
+		&args.ProxyExpect,
+		"proxy-expect-continue-timeout",
+		time.Second,
+		"How long to wait for a proxy backend to answer Expect: 100-continue before sending the body",
+	)
+	fs.BoolVar(
+		&args.DebugBodies,
+		"debug-bodies",
+		false,
+		"Log truncated, redacted bodies of a sample of proxied requests (for debugging only)",
+	)
+	fs.Float64Var(
+		&args.DebugSample,
+		"debug-bodies-sample",
+		0.1,
+		"Fraction of proxied requests whose bodies -debug-bodies logs",
+	)
+	fs.IntVar(
+		&args.DebugLimit,
+		"debug-bodies-limit",
+		1024,
+		"Maximum number of bytes of each body -debug-bodies logs",
+	)
+	fs.StringVar(
+		&args.DebugRedact,
+		"debug-bodies-redact",
+		"Authorization,Cookie,Set-Cookie,password,token,secret",
+		"Comma-separated header and JSON field names whose values -debug-bodies hides",
+	)
+	fs.DurationVar(
+		&args.ProxyCache,
+		"cache-responses-ttl",
+		0,
+		"Cache cacheable proxied GET responses for up to this long (0 to disable)",
+	)
+	fs.StringVar(
+		&args.LBCheckPath,
+		"lb-check-path",
+		"",
+		"Path (e.g. /lb-check) that answers load balancer checks with an empty 200",
+	)
+	fs.BoolVar(
+		&args.ZipDownloads,
+		"zip-downloads",
+		false,
+		"Serve zip archives of directories at /download.zip?path=/some/dir",
+	)
+	fs.BoolVar(
+		&args.NoSniff,
+		"nosniff",
+		false,
+		"Send X-Content-Type-Options: nosniff and always declare a Content-Type",
+	)
+	fs.StringVar(
+		&args.RootRedirect,
+		"root-redirect",
+		"",
+		"Path (e.g. /en/) that requests for / are redirected to",
+	)
+	fs.BoolVar(
+		&args.HeadAsGet,
+		"head-as-get",
+		false,
+		"Answer HEAD requests for files by running the GET logic and dropping the body",
+	)
+	fs.StringVar(
+		&args.StagingDir,
+		"staging-dir",
+		"",
+		"Directory to deploy new content into; SIGUSR1 swaps it with the served one",
+	)
+	fs.IntVar(
+		&args.CopyBuffer,
+		"copy-buffer-size",
+		32*1024,
+		"Buffer size in bytes for copying file content that can't use sendfile",
+	)
+	fs.Var(
+		args.AppConfig,
+		"app-config",
+		"A key=value pair (value may use $ENV_VARS) to serve in the app config JSON (repeatable)",
+	)
+	fs.StringVar(
+		&args.AppConfigURL,
+		"app-config-path",
+		"/config.json",
+		"Path the app config JSON is served at, unless a real file exists there",
+	)
+	fs.BoolVar(
+		&args.StrictPaths,
+		"reject-control-chars",
+		true,
+		"Reject request paths containing null bytes or control characters with 400",
+	)
+	fs.StringVar(
+		&args.DefaultHost,
+		"default-host",
+		"",
+		"Host assumed for requests without one, e.g. from HTTP/1.0 clients (defaults to -domain)",
+	)
+	fs.BoolVar(
+		&args.Dev,
+		"dev",
+		false,
+		"Development mode: missing non-HTML assets return a descriptive 404 instead of index.html",
+	)
+	fs.BoolVar(
+		&args.Isolate,
+		"coop-coep",
+		false,
+		"Send cross-origin isolation headers (COOP/COEP on pages, CORP on assets)",
+	)
+	fs.BoolVar(
+		&args.NoSymlinks,
+		"no-follow-symlinks",
+		false,
+		"Respond with 404 for files reached through symlinks pointing outside -rootdir",
+	)
+	fs.IntVar(
+		&args.MaxActive,
+		"max-concurrent",
+		0,
+		"Maximum number of requests handled at once (0 for no limit)",
+	)
+	fs.IntVar(
+		&args.QueueSize,
+		"queue-size",
+		100,
+		"Maximum number of requests waiting, in arrival order, when -max-concurrent is reached",
+	)
+	fs.DurationVar(
+		&args.RenewCheck,
+		"renew-check-interval",
+		simplecert.Default.CheckInterval,
+		"How often to check whether the SSL certificate is due for renewal",
+	)
+	fs.BoolVar(
+		&args.UpgradeOnly,
+		"upgrade-required",
+		false,
+		"Answer plain HTTP requests with 426 Upgrade Required instead of redirecting to HTTPS",
+	)
+	fs.BoolVar(
+		&args.RedirectHTTP,
+		"redirect-http",
+		false,
+		"Redirect plain HTTP requests on -http-port to HTTPS with a 301, also with -tls-cert",
+	)
+	fs.IntVar(
+		&args.HTTPPort,
+		"http-port",
+		80,
+		"Port plain HTTP requests are redirected or refused on when serving TLS",
+	)
+	fs.IntVar(
+		&args.MaxOpenFiles,
+		"max-open-files",
+		0,
+		"Maximum number of files open for serving at once (0 for no limit)",
+	)
+	fs.DurationVar(
+		&args.OpenWait,
+		"max-open-files-wait",
+		time.Second,
+		"How long a request waits for a file slot before getting a 503",
+	)
+	fs.BoolVar(
+		&args.LogErrors,
+		"log-errors-only",
+		false,
+		"Log requests that end in a 4xx or 5xx response",
+	)
+	fs.StringVar(
+		&args.LogFormat,
+		"log-format",
+		"",
+		"Log every request, as text or json (one object per line)",
+	)
+	fs.BoolVar(
+		&args.LogTotals,
+		"log-totals",
+		false,
+		"Log the number of requests handled and bytes served on shutdown",
+	)
+	fs.StringVar(
+		&args.UnknownHost,
+		"unknown-host-action",
+		"",
+		"Response to requests for hosts other than -domain and -proxy-host ones: 404, 421 or redirect (to -domain)",
+	)
+	fs.BoolVar(
+		&args.PreGzip,
+		"pregzip",
+		false,
+		"Gzip all text assets into memory at startup and serve those to clients that accept gzip",
+	)
+	fs.StringVar(
+		&args.OnStart,
+		"on-start",
+		"",
+		"Shell command to run once the server is listening; failure stops the server",
+	)
+	fs.StringVar(
+		&args.OnStop,
+		"on-stop",
+		"",
+		"Shell command to run after the server has shut down",
+	)
+	fs.StringVar(
+		&args.NoRanges,
+		"no-ranges-prefix",
+		"",
+		"Comma-separated path prefixes for which range requests are ignored",
+	)
+	fs.BoolVar(
+		&args.Stats,
+		"stats",
+		false,
+		"Serve a JSON summary of request counts and latency at /stats",
+	)
+	fs.StringVar(
+		&args.AdminToken,
+		"admin-token",
+		"",
+		"Bearer token required for admin endpoints such as /stats",
+	)
+	fs.StringVar(
+		&args.BuildTime,
+		"build-time",
+		os.Getenv("BUILD_TIME"),
+		"RFC 3339 time reported as Last-Modified for all static responses (defaults to $BUILD_TIME)",
+	)
+	fs.StringVar(
+		&args.IndexChain,
+		"index-chain",
+		"index.html",
+		"Comma-separated index files to try in order for the SPA fallback",
+	)
+	fs.StringVar(
+		&args.GeoLocales,
+		"geo-locale-map",
+		"",
+		"Redirect / by country, as COUNTRY=/path/ pairs (e.g. US=/en/,FR=/fr/); -root-redirect is the default",
+	)
+	fs.StringVar(
+		&args.GeoHeader,
+		"geo-header",
+		"CF-IPCountry",
+		"Request header carrying the client's country code",
+	)
+	fs.IntVar(
+		&args.MaxHandshakes,
+		"max-handshakes",
+		0,
+		"Maximum number of concurrent TLS handshakes (0 for no limit)",
+	)
+	fs.StringVar(
+		&args.APIPrefix,
+		"api-prefix",
+		"",
+		"Path prefix (e.g. /api) under which missing paths get a JSON 404 instead of index.html",
+	)
+	fs.BoolVar(
+		&args.Precompressed,
+		"precompressed",
+		true,
+		"Serve build-time .br and .gz siblings of files to clients that accept them",
+	)
+	fs.BoolVar(
+		&args.Gzip,
+		"gzip",
+		true,
+		"Gzip compressible responses on the fly for clients that accept it",
+	)
+	fs.StringVar(
+		&args.CompressExt,
+		"compress-ext",
+		"",
+		"Comma-separated extensions (e.g. .js,.css,.html) to limit -gzip to; paths without one count as .html",
+	)
+	fs.IntVar(
+		&args.GzipMinBytes,
+		"gzip-min-bytes",
+		1024,
+		"Smallest response, in bytes, that -gzip compresses",
+	)
+	fs.BoolVar(
+		&args.GzipLength,
+		"gzip-index-length",
+		false,
+		"Compress the index in memory before sending it, so it has a Content-Length instead of being chunked",
+	)
+	fs.Float64Var(
+		&args.RateLimit,
+		"rate-limit",
+		0,
+		"Requests per second allowed from each client IP, beyond which it gets 429s (0 for no limit)",
+	)
+	fs.IntVar(
+		&args.RateBurst,
+		"rate-burst",
+		20,
+		"Number of requests a client may make at once before -rate-limit applies",
+	)
+	fs.StringVar(
+		&args.TrustedProxy,
+		"trusted-proxy",
+		"",
+		"Comma-separated IPs and CIDR networks of proxies whose X-Forwarded-For identifies the client for -rate-limit",
+	)
+	fs.Float64Var(
+		&args.CompressCPU,
+		"compress-cpu-threshold",
+		0,
+		"One-minute load average per CPU above which -gzip sends responses uncompressed (0 to always compress)",
+	)
+	fs.StringVar(
+		&args.SourceMapIPs,
+		"sourcemap-allowlist",
+		"",
+		"Comma-separated IPs and CIDR networks that .map files are served to; others get 404",
+	)
+	fs.IntVar(
+		&args.Bandwidth,
+		"bandwidth-limit",
+		0,
+		"Maximum rate, in bytes per second, at which each response is sent (0 for no limit)",
+	)
+	fs.StringVar(
+		&args.AssetPattern,
+		"asset-pattern",
+		defaultAssetPattern,
+		"Regular expression matching fingerprinted file names to cache as immutable (empty to disable)",
+	)
+	fs.DurationVar(
+		&args.StaticMaxAge,
+		"static-max-age",
+		365*24*time.Hour,
+		"How long clients may cache files matching -asset-pattern",
+	)
+	fs.StringVar(
+		&args.NoFallback,
+		"fallback-exclude",
+		"",
+		"Comma-separated path prefixes (e.g. /api,/graphql) under which missing paths get a 404 instead of index.html",
+	)
+	fs.StringVar(
+		&args.NotFoundFile,
+		"notfound-file",
+		"",
+		"File served as the body of -fallback-exclude 404s (a plain text 404 if unset or missing)",
+	)
+	fs.BoolVar(
+		&args.DebugServed,
+		"debug-served-file",
+		false,
+		"Add an X-Served-File header naming the file behind each response (development only)",
+	)
+	fs.StringVar(
+		&args.BasePath,
+		"base-path",
+		"",
+		"Path prefix (e.g. /admin) the app and /ping are served under; other paths get 404",
+	)
+	fs.BoolVar(
+		&args.GenIndex,
+		"generate-index",
+		false,
+		"Serve a generated SPA shell when the static directory has no index file",
+	)
+	fs.StringVar(
+		&args.AppTitle,
+		"app-title",
+		"App",
+		"Title of the generated index",
+	)
+	fs.StringVar(
+		&args.AppRootID,
+		"app-root-id",
+		"root",
+		"Id of the element the app mounts on in the generated index",
+	)
+	fs.BoolVar(
+		&args.EnvInject,
+		"env-inject",
+		false,
+		"Inject environment variables starting with -env-prefix into the index as window.__ENV__",
+	)
+	fs.StringVar(
+		&args.BustAssets,
+		"bust-assets",
+		"",
+		"Deploy version added as a v= query parameter to the root-relative src and href URLs in the served index",
+	)
+	fs.StringVar(
+		&args.InlineCSS,
+		"inline-css",
+		"",
+		"Critical CSS file inlined into the served index, replacing <!-- inline-css -->, the -inline-css-href link, or before </head>",
+	)
+	fs.StringVar(
+		&args.InlineCSSHref,
+		"inline-css-href",
+		"",
+		"href of the stylesheet <link> in the index that -inline-css replaces",
+	)
+	fs.StringVar(
+		&args.EnvPrefix,
+		"env-prefix",
+		"SPA_",
+		"Prefix of the environment variables -env-inject exposes to the app",
+	)
+	fs.StringVar(
+		&args.AllowExt,
+		"allow-ext",
+		"",
+		"Comma-separated file extensions (e.g. .html,.js,.css) that may be served; requests for others get 404",
+	)
+	fs.StringVar(
+		&args.CORSOrigins,
+		"cors-origins",
+		"",
+		"Comma-separated origins allowed to make cross-origin requests (* for any)",
+	)
+	fs.StringVar(
+		&args.CORSMethods,
+		"cors-methods",
+		"",
+		"Comma-separated methods allowed in cross-origin requests (defaults to GET, POST and HEAD)",
+	)
+	fs.StringVar(
+		&args.CORSHeaders,
+		"cors-headers",
+		"",
+		"Comma-separated non-simple headers allowed in cross-origin requests",
+	)
+	fs.BoolVar(
+		&args.CORSCreds,
+		"cors-credentials",
+		false,
+		"Allow cross-origin requests with credentials (requires explicit -cors-origins)",
+	)
+	fs.StringVar(
+		&args.ConfigFile,
+		"config",
+		"",
+		"JSON file of settings keyed by flag name; flags and SPA_* environment variables override it",
+	)
+	fs.BoolVar(
+		&args.WatchConfig,
+		"watch-config",
+		false,
+		"Apply changes to the -config file while running; settings that need a restart, such as -port, are logged instead",
+	)
+	if err := fs.Parse(arguments); err != nil {
+		return args, err
+	}
+	err := applyConfig(fs, args.ConfigFile)
+	return args, err
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// flagPassed reports whether the named flag was given on the command
+// line, as opposed to left at its default.
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
 }
 
 func certAndKey(certCache string) (string, string) {
 	return path.Join(certCache, "cert.pem"), path.Join(certCache, "key.pem")
 }
 
-func serveTLS(srv *http.Server, certCache string) {
-	cert, key := certAndKey(certCache)
+// upgradeRequired tells plain HTTP clients to retry over TLS rather than
+// redirecting them, so nothing sensitive is ever sent in the clear.
+func upgradeRequired(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Upgrade", "TLS/1.2, HTTP/1.1")
+	w.Header().Set("Connection", "Upgrade")
+	http.Error(w, http.StatusText(http.StatusUpgradeRequired), http.StatusUpgradeRequired)
+}
+
+// httpsRedirect redirects plain HTTP requests to the same host, path and
+// query over HTTPS on tlsPort.
+func httpsRedirect(tlsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, httpsURL(r, tlsPort), http.StatusMovedPermanently)
+	})
+}
+
+// httpsURL returns the https:// equivalent of the request's URL.
+func httpsURL(r *http.Request, tlsPort int) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if tlsPort != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(tlsPort))
+	} else if strings.Contains(host, ":") {
+		// an IPv6 literal needs its brackets back
+		host = "[" + host + "]"
+	}
+	return "https://" + host + r.URL.RequestURI()
+}
+
+// serveTLS listens on srv.Addr and serves TLS there in the background,
+// returning once the listener is open.
+func serveTLS(srv *http.Server, cert, key string, maxHandshakes int) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
 	go func() {
-		if err := srv.ListenAndServeTLS(cert, key); err != nil && err != http.ErrServerClosed {
+		var err error
+		if maxHandshakes > 0 {
+			err = serveLimitedTLS(srv, ln, cert, key, maxHandshakes)
+		} else {
+			err = srv.ServeTLS(ln, cert, key)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %+s\n", err)
 		}
 	}()
+	return nil
 }
 
 func main() {
 	args := parseArgs()
 
-	// web server
-	const (
-		writeTimeout = 1 * 60
-		readTimeout  = 1 * 60
-		idleTimeout  = 2 * 60
-	)
+	if args.WatchConfig && configPath(args.ConfigFile) == "" {
+		log.Fatal("-watch-config needs -config or SPA_CONFIG")
+	}
 
-	if args.SSL {
+	manualTLS := args.TLSCert != "" || args.TLSKey != ""
+	if manualTLS {
+		if args.TLSCert == "" || args.TLSKey == "" {
+			log.Fatal("-tls-cert and -tls-key must be given together")
+		}
+		if args.CertCache != "" || args.SSLEmail != "" {
+			log.Fatal("-tls-cert and -tls-key cannot be combined with -certcache or -sslemail")
+		}
+		if _, err := tls.LoadX509KeyPair(args.TLSCert, args.TLSKey); err != nil {
+			log.Fatal("Invalid TLS certificate: ", err)
+		}
+		names := certNames(args.Domain, args.Host)
+		if err := validateCert(args.TLSCert, args.TLSKey, names, args.StrictCert); err != nil {
+			log.Fatal("Certificate doesn't match: ", err)
+		}
+	} else if args.SSL {
 		if args.Port != 443 {
 			args.Port = 443
 			log.Println("Port set to 443 since SSL enabled")
@@ -164,94 +1473,317 @@ func main() {
 			log.Fatal("SSL Email if SSL enabled")
 		}
 	}
+	if args.HSTS && !args.SSL && !manualTLS {
+		log.Println("Warning: -hsts has no effect without -ssl or -tls-cert")
+	}
+	var unixMode os.FileMode
+	if args.UnixSocket != "" {
+		if args.SSL || manualTLS {
+			log.Fatal("-unix-socket cannot be combined with -ssl or -tls-cert")
+		}
+		mode, err := strconv.ParseUint(args.UnixMode, 8, 32)
+		if err != nil {
+			log.Fatal("Invalid Unix socket mode: ", err)
+		}
+		unixMode = os.FileMode(mode)
+	}
+	if (args.TicketKeys != "" || args.TicketRotate > 0) && !args.SSL && !manualTLS {
+		log.Fatal("-tls-ticket-keys and -tls-ticket-rotate require -ssl or -tls-cert")
+	}
+	if args.RedirectHTTP && !args.SSL && !manualTLS {
+		log.Fatal("-redirect-http requires -ssl or -tls-cert")
+	}
+	if args.HTTP3 {
+		if !args.SSL && !manualTLS {
+			log.Fatal("-http3 requires -ssl or -tls-cert")
+		}
+		if !http3Supported {
+			log.Fatal("-http3 needs a binary built with -tags http3")
+		}
+	}
+	if !logFormats[args.LogFormat] {
+		log.Fatal("Log format must be text or json")
+	}
+	if !unknownHostActions[args.UnknownHost] {
+		log.Fatal("Unknown host action must be one of 404, 421 or redirect")
+	}
+	if args.UnknownHost != "" && args.Domain == "" && len(args.ProxyHosts) == 0 {
+		log.Fatal("Unknown host action requires -domain or -proxy-host")
+	}
+	if args.UnknownHost == "redirect" && args.Domain == "" {
+		log.Fatal("Redirecting unknown hosts requires -domain")
+	}
+	if args.CopyBuffer <= 0 {
+		log.Fatal("Copy buffer size must be positive")
+	}
 	addr := fmt.Sprintf("%s:%d", args.Host, args.Port)
 
-	makeServer := func(rootDir, addr string) *http.Server {
-		r := mux.NewRouter()
+	s, err := newSite(args)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	srv := s.makeServer(args, addr)
 
-		// ping for convenience
-		r.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte("{\"response\": \"pong\"}"))
-		}).Methods("GET")
+	// with -watch-config, requests go through live so that a reload can
+	// swap in a handler rebuilt with the new settings
+	var live *swapHandler
+	if args.WatchConfig {
+		live = newSwapHandler(srv.Handler)
+		srv.Handler = live
+	}
 
-		spa := spaHandler{
-			staticPath: rootDir,
-			indexPath:  "index.html",
-		}
-		r.PathPrefix("/").Handler(spa)
+	// running tracks the server as certificate renewals replace it
+	running := newLiveServer(srv, args.Wait, nil)
 
-		handler := cors.Default().Handler(r)
-		return &http.Server{
-			Handler:      handler,
-			Addr:         addr,
-			WriteTimeout: writeTimeout * time.Second,
-			ReadTimeout:  readTimeout * time.Second,
-			IdleTimeout:  idleTimeout * time.Second,
+	// settingsMu guards settings, the arguments as last reloaded
+	var (
+		settingsMu sync.Mutex
+		settings   = args
+	)
+
+	// plainSrv, when serving TLS, redirects plain HTTP requests to HTTPS
+	// or insists on it
+	var plainSrv *http.Server
+	servePlain := func(redirect http.Handler) *http.Server {
+		if args.RedirectHTTP {
+			redirect = httpsRedirect(args.Port)
+		}
+		if args.UpgradeOnly {
+			redirect = http.HandlerFunc(upgradeRequired)
 		}
+		plain := &http.Server{Addr: fmt.Sprintf(":%d", args.HTTPPort), Handler: redirect}
+		go func() {
+			if err := plain.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Println("plain HTTP listener:", err)
+			}
+		}()
+		return plain
 	}
 
-	srv := makeServer(args.RootDir, addr)
+	// h3Srv, if set, serves HTTP/3 alongside the TLS server. It keeps
+	// running across certificate renewals, which only need TCP.
+	var h3Srv http3Server
 
-	// run in goroutine to avoid blocking
-	ctx, cancel := context.WithTimeout(context.Background(), args.Wait)
-	defer cancel()
-	if args.SSL {
+	// tickets, if set, rotates the TLS session ticket keys
+	var tickets *ticketKeyRotator
+	ticketKeys := args.TicketKeys != "" || args.TicketRotate > 0
+	rotateTicketKeys := func(config *tls.Config) *ticketKeyRotator {
+		t, err := newTicketKeyRotator(args.TicketKeys, config)
+		if err != nil {
+			log.Fatal("Failed to load TLS session ticket keys: ", err)
+		}
+		if args.TicketRotate > 0 {
+			go func() {
+				for range time.Tick(args.TicketRotate) {
+					if err := t.rotate(); err != nil {
+						log.Println("Failed to rotate TLS session ticket keys:", err)
+					}
+				}
+			}()
+		}
+		return t
+	}
+
+	// serve starts the server in the background once its listener is open
+	var serve func() error
+	if args.SSL && !manualTLS {
 		var (
 			certReloader *simplecert.CertReloader
 			numRenews    int
-			cfg          = simplecert.Default
 			tlsConf      = tlsconfig.NewServerTLSConfig(tlsconfig.TLSModeServerStrict)
 		)
 
-		cfg.Domains = []string{args.Domain}
-		cfg.CacheDir = args.CertCache
-		cfg.SSLEmail = args.SSLEmail
-		cfg.HTTPAddress = ""
-
-		cfg.WillRenewCertificate = func() {
-			cancel()
+		cert, key := certAndKey(args.CertCache)
+		cfg, err := certConfig(args)
+		if err != nil {
+			log.Fatal("Invalid configuration: ", err)
 		}
 
-		cfg.DidRenewCertificate = func() {
+		cfg.WillRenewCertificate = running.willRenew
+		cfg.DidRenewCertificate = running.didRenew
+		running.restart = func() *http.Server {
 			numRenews++
-			srv = makeServer(args.RootDir, addr)
-			srv.TLSConfig = tlsConf
+			settingsMu.Lock()
+			next := s.makeServer(settings, addr)
+			settingsMu.Unlock()
+			if live != nil {
+				live.set(next.Handler)
+				next.Handler = live
+			}
+			next.TLSConfig = tlsConf
 
 			certReloader.ReloadNow()
 
-			serveTLS(srv, args.CertCache)
+			if err := serveTLS(next, cert, key, args.MaxHandshakes); err != nil {
+				log.Fatal("Failed to restart server after certificate renewal: ", err)
+			}
+			return next
 		}
 
-		certReloader, err := simplecert.Init(cfg, func() {
+		certReloader, err = simplecert.Init(cfg, func() {
 			os.Exit(0)
 		})
 		if err != nil {
 			log.Fatal("simplecert init failed: ", err)
 		}
 
-		// redirect to HTTPS
-		go http.ListenAndServe(":80", http.HandlerFunc(simplecert.Redirect))
+		plainSrv = servePlain(http.HandlerFunc(simplecert.Redirect))
 
 		// enable hot reload
 		tlsConf.GetCertificate = certReloader.GetCertificateFunc()
 
-		serveTLS(srv, args.CertCache)
+		if ticketKeys {
+			srv.TLSConfig = tlsConf
+			tickets = rotateTicketKeys(tlsConf)
+		}
+		if args.HTTP3 {
+			h3Srv = serveHTTP3(addr, srv.Handler, tlsConf)
+		}
+		serve = func() error {
+			return serveTLS(srv, cert, key, args.MaxHandshakes)
+		}
+	} else if manualTLS {
+		// certificates are managed elsewhere; no ACME, and plain HTTP is
+		// only answered if asked for
+		if args.RedirectHTTP || args.UpgradeOnly {
+			plainSrv = servePlain(httpsRedirect(args.Port))
+		}
+		if ticketKeys {
+			pair, err := tls.LoadX509KeyPair(args.TLSCert, args.TLSKey)
+			if err != nil {
+				log.Fatal("Invalid TLS certificate: ", err)
+			}
+			srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{pair}}
+			tickets = rotateTicketKeys(srv.TLSConfig)
+		}
+		if args.HTTP3 {
+			config := srv.TLSConfig
+			if config == nil {
+				pair, err := tls.LoadX509KeyPair(args.TLSCert, args.TLSKey)
+				if err != nil {
+					log.Fatal("Invalid TLS certificate: ", err)
+				}
+				config = &tls.Config{Certificates: []tls.Certificate{pair}}
+			}
+			h3Srv = serveHTTP3(addr, srv.Handler, config)
+		}
+		serve = func() error {
+			return serveTLS(srv, args.TLSCert, args.TLSKey, args.MaxHandshakes)
+		}
 	} else {
+		serve = func() error {
+			var ln net.Listener
+			var err error
+			if args.UnixSocket != "" {
+				ln, err = listenUnix(args.UnixSocket, unixMode)
+			} else {
+				ln, err = net.Listen("tcp", addr)
+			}
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := srv.Serve(ln); err != nil {
+					log.Println(err)
+				}
+			}()
+			return nil
+		}
+	}
+
+	lc := newLifecycle(s.ready, running.stop, os.Exit)
+	lc.readyDelay = args.ReadyDelay
+	lc.wait = args.Wait
+	lc.onStart = args.OnStart
+	lc.onStop = args.OnStop
+	if plainSrv != nil {
+		lc.others = append(lc.others, plainSrv)
+	}
+	if h3Srv != nil {
+		lc.others = append(lc.others, h3Srv)
+	}
+	if err := lc.start(serve); err != nil {
+		log.Fatal(err)
+	}
+
+	if s.staged != nil {
+		promote := make(chan os.Signal, 1)
+		signal.Notify(promote, promoteSignals...)
 		go func() {
-			if err := srv.ListenAndServe(); err != nil {
-				log.Println(err)
+			for range promote {
+				dir, err := s.staged.promote()
+				if err != nil {
+					log.Println("Failed to promote staging directory:", err)
+					continue
+				}
+				if s.index != nil {
+					if err := s.index.loadFrom(findIndex(dir, s.indexPath, s.altIndexes)); err != nil {
+						log.Println("Failed to reload index:", err)
+					}
+				}
+				log.Println("Now serving", dir)
 			}
 		}()
 	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT)
+	if args.WatchConfig {
+		reloader := &configReloader{
+			arguments: os.Args[1:],
+			flags:     flag.CommandLine,
+			args:      args,
+			apply: func(applied CmdLineArgs) {
+				settingsMu.Lock()
+				defer settingsMu.Unlock()
+				settings = applied
+				live.set(s.makeServer(applied, addr).Handler)
+				if s.index != nil && s.staged == nil {
+					// -rootdir may have changed
+					if err := s.index.loadFrom(findIndex(applied.RootDir, s.indexPath, s.altIndexes)); err != nil {
+						log.Println("Failed to reload index:", err)
+					}
+				}
+			},
+		}
+		go reloader.watch(configPath(args.ConfigFile), configPollInterval)
+	}
+
+	// SIGHUP reloads the preloaded index and TLS session ticket keys
+	// rather than shutting down
+	stopSignals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+	if s.index != nil || tickets != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if s.index != nil {
+					if err := s.index.load(); err != nil {
+						log.Println("Failed to reload index:", err)
+					} else {
+						log.Println("Reloaded index")
+					}
+				}
+				if tickets != nil {
+					if err := tickets.rotate(); err != nil {
+						log.Println("Failed to rotate TLS session ticket keys:", err)
+					} else {
+						log.Println("Rotated TLS session ticket keys")
+					}
+				}
+			}
+		}()
+	} else {
+		stopSignals = append(stopSignals, syscall.SIGHUP)
+	}
 
-	// block until we receive our signal
-	<-c
-	err := srv.Shutdown(ctx)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, stopSignals...)
 
-	log.Println("Shutting down...")
+	// block until we receive our signal, then drain
+	err = lc.Run(c)
+	if args.LogTotals {
+		log.Println("Totals:", s.totals)
+	}
 	if err == http.ErrServerClosed {
 		log.Println("Server exited properly")
 	} else if err != nil {
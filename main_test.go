@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestServer builds the server main would for arguments, which are
+// parsed as command line flags.
+func newTestServer(t *testing.T, arguments ...string) *http.Server {
+	t.Helper()
+	args, err := parseArgsFrom(flag.NewFlagSet("test", flag.ContinueOnError), arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSite(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.makeServer(args, "")
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, ""},
+		{-time.Second, ""},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		setRetryAfter(h, tt.d)
+		if got := h.Get("Retry-After"); got != tt.want {
+			t.Errorf("setRetryAfter(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	w := httptest.NewRecorder()
+	serviceUnavailable(w, 5*time.Second)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+		t.Errorf("got %d with Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestHideIndexRedirects(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js")
+	h := spaHandler{staticPath: root, indexPath: "index.html", hideIndex: true}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/index.html?utm=x", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "./?utm=x" {
+		t.Errorf("/index.html: got %d to %q, want a 301 to ./?utm=x", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "index.html" {
+		t.Errorf("/: got %d %q, want the index", w.Code, w.Body.String())
+	}
+}
+
+func TestNoFollowSymlinks(t *testing.T) {
+	outside := writeTree(t, "secret.txt", "secret.txt.gz", "index.html")
+	root := writeTree(t, "index.html", "app.js", "docs/readme.txt")
+	links := map[string]string{
+		"link.txt":        "secret.txt",
+		"docs/index.html": "index.html",
+		"app.js.gz":       "secret.txt.gz",
+	}
+	for name, target := range links {
+		if err := os.Symlink(filepath.Join(outside, target), filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks unsupported:", err)
+		}
+	}
+	h := spaHandler{staticPath: root, indexPath: "index.html", noFollowSymlinks: true, precompressed: true}
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/app.js", http.StatusOK, "app.js"},
+		{"/link.txt", http.StatusNotFound, ""},
+		{"/docs/", http.StatusNotFound, ""},
+		{"/missing", http.StatusOK, "index.html"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	// a fallback index that is itself a link out of the root
+	root = writeTree(t, "app.js")
+	if err := os.Symlink(filepath.Join(outside, "index.html"), filepath.Join(root, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	h.staticPath = root
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("linked fallback index: status = %d, want 404", w.Code)
+	}
+}
+
+// readerFromRecorder records what the server copies the body from, as
+// the net/http writer's ReadFrom sees it.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	src io.Reader
+}
+
+func (w *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.src = src
+	if lr, ok := src.(*io.LimitedReader); ok {
+		w.src = lr.R
+	}
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestServeFileKeepsSendfile(t *testing.T) {
+	root := t.TempDir()
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<12)
+	if err := ioutil.WriteFile(filepath.Join(root, "big.bin"), body, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := spaHandler{staticPath: root, indexPath: "index.html"}
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/big.bin", nil))
+
+	if !bytes.Equal(w.Body.Bytes(), body) {
+		t.Fatal("body differs from the file")
+	}
+	if _, ok := w.src.(*os.File); !ok {
+		t.Errorf("body copied from %T, want *os.File so sendfile can be used", w.src)
+	}
+
+	// the middleware the default flags wrap around it must not hide the
+	// writer's ReadFrom either
+	captureLog(t)
+	srv := newTestServer(t, "-rootdir", root)
+	for _, encoding := range []string{"", "gzip"} {
+		r := httptest.NewRequest("GET", "/big.bin", nil)
+		r.Header.Set("Accept-Encoding", encoding)
+		w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		srv.Handler.ServeHTTP(w, r)
+		if !bytes.Equal(w.Body.Bytes(), body) {
+			t.Fatalf("default server, Accept-Encoding %q: body differs from the file", encoding)
+		}
+		if _, ok := w.src.(*os.File); !ok {
+			t.Errorf("default server, Accept-Encoding %q: body copied from %T, want *os.File so sendfile can be used", encoding, w.src)
+		}
+	}
+}
+
+// BenchmarkServeFile serves a large file over a real connection, with
+// the sendfile path and with the writer's ReadFrom hidden from it.
+func BenchmarkServeFile(b *testing.B) {
+	root := b.TempDir()
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	if err := ioutil.WriteFile(filepath.Join(root, "big.bin"), body, 0644); err != nil {
+		b.Fatal(err)
+	}
+	h := spaHandler{staticPath: root, indexPath: "index.html"}
+	handlers := map[string]http.Handler{
+		"sendfile": h,
+		"copy": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(struct{ http.ResponseWriter }{w}, r)
+		}),
+	}
+	for _, name := range []string{"sendfile", "copy"} {
+		b.Run(name, func(b *testing.B) {
+			srv := httptest.NewServer(handlers[name])
+			defer srv.Close()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				resp, err := http.Get(srv.URL + "/big.bin")
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestTimingAllowOrigin(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js")
+	h := spaHandler{staticPath: root, indexPath: "index.html", timingAllowOrigin: "https://rum.example.com"}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if got := w.Header().Get("Timing-Allow-Origin"); got != "https://rum.example.com" {
+		t.Errorf("Timing-Allow-Origin = %q, want https://rum.example.com", got)
+	}
+
+	h.timingAllowOrigin = ""
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if _, ok := w.Header()["Timing-Allow-Origin"]; ok {
+		t.Error("Timing-Allow-Origin set without -timing-allow-origin")
+	}
+}
+
+func TestUpgradeRequired(t *testing.T) {
+	w := httptest.NewRecorder()
+	upgradeRequired(w, httptest.NewRequest("GET", "http://example.com/", nil))
+	if w.Code != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want 426", w.Code)
+	}
+	if w.Header().Get("Upgrade") != "TLS/1.2, HTTP/1.1" || w.Header().Get("Connection") != "Upgrade" {
+		t.Errorf("Upgrade %q, Connection %q", w.Header().Get("Upgrade"), w.Header().Get("Connection"))
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js")
+	h := spaHandler{
+		staticPath: root,
+		indexPath:  "index.html",
+		openFiles:  make(chan struct{}, 1),
+		openWait:   10 * time.Millisecond,
+		retryAfter: time.Second,
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if w.Code != http.StatusOK || len(h.openFiles) != 0 {
+		t.Fatalf("status = %d with %d slots held, want 200 and none", w.Code, len(h.openFiles))
+	}
+
+	// with every slot taken, requests give up after openWait
+	h.openFiles <- struct{}{}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("got %d with Retry-After %q, want a 503 with 1", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestIndexChain(t *testing.T) {
+	root := writeTree(t, "app.html", "shell.html")
+	alternatives := []string{"missing.html", "app.html", "shell.html"}
+	if got, want := findIndex(root, "index.html", alternatives), filepath.Join(root, "app.html"); got != want {
+		t.Errorf("findIndex = %q, want %q", got, want)
+	}
+
+	h := spaHandler{staticPath: root, indexPath: "index.html", altIndexes: alternatives}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "app.html" {
+		t.Errorf("got %d %q, want the first index in the chain", w.Code, w.Body.String())
+	}
+
+	// the primary index wins once it exists
+	root = writeTree(t, "index.html", "app.html")
+	if got, want := findIndex(root, "index.html", alternatives), filepath.Join(root, "index.html"); got != want {
+		t.Errorf("findIndex = %q, want %q", got, want)
+	}
+}
+
+func TestIndexIsDirectory(t *testing.T) {
+	root := writeTree(t, "index.html/nested.txt")
+	h := spaHandler{staticPath: root, indexPath: "index.html"}
+	captureLog(t)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/some/route", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500 for a directory index", w.Code)
+	}
+}
+
+func TestFallbackExclude(t *testing.T) {
+	root := writeTree(t, "index.html", "404.html")
+	h := spaHandler{
+		staticPath:      root,
+		indexPath:       "index.html",
+		fallbackExclude: []string{"/static", "/api/"},
+		notFoundFile:    filepath.Join(root, "404.html"),
+	}
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/static/missing.js", http.StatusNotFound, "404.html"},
+		{"/api/users", http.StatusNotFound, "404.html"},
+		{"/statistics", http.StatusOK, "index.html"},
+		{"/some/route", http.StatusOK, "index.html"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestDebugServedFile(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js", "docs/index.html")
+	h := spaHandler{staticPath: root, indexPath: "index.html", debugServedFile: true}
+	for path, want := range map[string]string{
+		"/app.js":     "app.js",
+		"/docs/":      "docs/index.html",
+		"/some/route": "index.html",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if got := w.Header().Get("X-Served-File"); got != want {
+			t.Errorf("%s: X-Served-File = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAllowExt(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js", "info.php", ".env")
+	h := spaHandler{
+		staticPath: root,
+		indexPath:  "index.html",
+		allowExt:   map[string]bool{".html": true, ".js": true},
+	}
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/app.js", http.StatusOK},
+		{"/info.php", http.StatusNotFound},
+		{"/.env", http.StatusNotFound},
+		{"/missing.php", http.StatusNotFound},
+		{"/some/route", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		host    string
+		tlsPort int
+		want    string
+	}{
+		{"example.com", 443, "https://example.com/a?b=c"},
+		{"example.com:8080", 443, "https://example.com/a?b=c"},
+		{"example.com:8080", 8443, "https://example.com:8443/a?b=c"},
+		{"[::1]:8080", 443, "https://[::1]/a?b=c"},
+		{"[::1]:8080", 8443, "https://[::1]:8443/a?b=c"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/a?b=c", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		httpsRedirect(tt.tlsPort).ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s to port %d: got %d to %q, want %q", tt.host, tt.tlsPort, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestNotFoundFile(t *testing.T) {
+	root := writeTree(t, "index.html", "errors/404.html")
+	h := spaHandler{
+		staticPath:      root,
+		indexPath:       "index.html",
+		fallbackExclude: []string{"/static"},
+		notFoundFile:    filepath.Join(root, "errors", "404.html"),
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("HEAD", "/static/missing.js", nil))
+	if w.Code != http.StatusNotFound || w.Body.Len() != 0 || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("HEAD: got %d %q with %d bytes", w.Code, w.Header().Get("Content-Type"), w.Body.Len())
+	}
+
+	// an unreadable file falls back to the plain 404
+	h.notFoundFile = filepath.Join(root, "missing.html")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/static/missing.js", nil))
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found\n" {
+		t.Errorf("missing -notfound-file: got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	captureLog(t)
+	h := newTestServer(t,
+		"-rootdir", writeTree(t, "index.html", "assets/app.js"),
+		"-base-path", "/admin",
+	).Handler
+
+	tests := []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/admin/assets/app.js", http.StatusOK, "assets/app.js", ""},
+		{"/admin/some/route", http.StatusOK, "index.html", ""},
+		{"/admin", http.StatusMovedPermanently, "", "/admin/"},
+		// outside the prefix, including paths that only share its first
+		// characters
+		{"/assets/app.js", http.StatusNotFound, "", ""},
+		{"/other/page", http.StatusNotFound, "", ""},
+		{"/admins/assets/app.js", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: got %d, want %d", test.path, w.Code, test.code)
+			continue
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: served %q, want %q", test.path, w.Body.String(), test.body)
+		}
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location %q, want %q", test.path, got, test.location)
+		}
+	}
+}
+
+func TestManualTLS(t *testing.T) {
+	captureLog(t)
+	certFile, keyFile := writeCert(t, []string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1)})
+	srv := newTestServer(t,
+		"-rootdir", writeTree(t, "index.html"),
+		"-tls-cert", certFile,
+		"-tls-key", keyFile,
+	)
+	srv.Addr = freeAddr(t)
+	defer srv.Close()
+	if err := serveTLS(srv, certFile, keyFile, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	pem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		t.Fatal("no certificate in", certFile)
+	}
+	conn, err := tls.Dial("tcp", srv.Addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	if !state.HandshakeComplete || len(state.PeerCertificates) == 0 {
+		t.Fatal("handshake did not complete")
+	}
+	if got := state.PeerCertificates[0].DNSNames; len(got) != 1 || got[0] != "localhost" {
+		t.Errorf("served a certificate for %q, want the one from -tls-cert", got)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get("https://" + srv.Addr + "/some/route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "index.html" {
+		t.Errorf("got %d %q over TLS, want the index", resp.StatusCode, body)
+	}
+}
+
+func TestRootRedirect(t *testing.T) {
+	captureLog(t)
+	h := newTestServer(t,
+		"-rootdir", writeTree(t, "index.html", "en/index.html"),
+		"-root-redirect", "/en/",
+	).Handler
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/en/" {
+		t.Errorf("/: got %d to %q, want a 302 to /en/", w.Code, w.Header().Get("Location"))
+	}
+
+	for _, path := range []string{"/en/", "/en/page", "/about"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+			t.Errorf("%s: got %d to %q, want it served without a redirect", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
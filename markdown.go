@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+)
+
+// isMarkdown reports whether the file at the given path is markdown.
+func isMarkdown(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".md"
+}
+
+// serveMarkdown renders the markdown file at path into a minimal HTML
+// page and serves it as text/html.
+func serveMarkdown(w http.ResponseWriter, r *http.Request, path string, modTime time.Time) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	title := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>")
+	buf.WriteString(html.EscapeString(title))
+	buf.WriteString("</title>\n</head>\n<body>\n")
+	if err := goldmark.Convert(src, &buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf.WriteString("</body>\n</html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, path, modTime, bytes.NewReader(buf.Bytes()))
+}
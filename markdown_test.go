@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownPrefix(t *testing.T) {
+	root := writeTree(t, "index.html", "docs/intro.md", "docsite/raw.md")
+	h := spaHandler{staticPath: root, indexPath: "index.html", markdownPrefix: "/docs"}
+	tests := []struct {
+		path     string
+		rendered bool
+	}{
+		{"/docs/intro.md", true},
+		{"/docsite/raw.md", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", tt.path, w.Code)
+		}
+		rendered := strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") &&
+			strings.Contains(w.Body.String(), "<body>")
+		if rendered != tt.rendered {
+			t.Errorf("%s: rendered = %v, want %v", tt.path, rendered, tt.rendered)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+)
+
+// mergedFS layers several filesystems into one. A name is looked up in
+// each layer in order and the first that has it wins, directories
+// included, so earlier layers take precedence over later ones.
+type mergedFS []fs.FS
+
+// mergeFS returns the layers merged, or the only layer if there is one.
+func mergeFS(layers ...fs.FS) fs.FS {
+	if len(layers) == 1 {
+		return layers[0]
+	}
+	return mergedFS(layers)
+}
+
+func (m mergedFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	for _, layer := range m {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMergeFS(t *testing.T) {
+	app := fstest.MapFS{
+		"index.html":    {Data: []byte("app index")},
+		"assets/app.js": {Data: []byte("app")},
+	}
+	plugin := fstest.MapFS{
+		"index.html":          {Data: []byte("plugin index")},
+		"plugins/chart.js":    {Data: []byte("chart")},
+		"assets/plugin-a.css": {Data: []byte("plugin css")},
+	}
+	merged := mergeFS(app, plugin)
+	for name, want := range map[string]string{
+		"index.html":          "app index",
+		"plugins/chart.js":    "chart",
+		"assets/plugin-a.css": "plugin css",
+	} {
+		got, err := fs.ReadFile(merged, name)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v, want %q", name, got, err, want)
+		}
+	}
+	// directories come from the first layer that has them
+	if entries, err := fs.ReadDir(merged, "assets"); err != nil || len(entries) != 1 {
+		t.Errorf("assets/ lists %d entries, %v, want only the app's", len(entries), err)
+	}
+	if _, err := merged.Open("missing.js"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := merged.Open("../escape"); err == nil {
+		t.Error("opened an invalid path")
+	}
+
+	if single := mergeFS(app); single == nil {
+		t.Error("mergeFS of one layer returned nil")
+	} else if _, ok := single.(mergedFS); ok {
+		t.Error("mergeFS of one layer wrapped it")
+	}
+}
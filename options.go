@@ -0,0 +1,31 @@
+package main
+
+import "net/http"
+
+// answerOptions responds to OPTIONS requests with 204 and the methods
+// the app supports, so they never fall through to the SPA. CORS
+// preflights reach it with their Access-Control headers already set.
+func answerOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", "GET, HEAD, POST, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// forwardOptions sends OPTIONS requests, CORS preflights included, for
+// paths proxied reports as proxied to backend rather than next, whose
+// CORS handling and answerOptions would answer them in the backend's
+// place.
+func forwardOptions(proxied func(*http.Request) bool, backend, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && proxied(r) {
+			backend.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	captureLog(t)
+	var backendMethod string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendMethod = r.Method
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.example")
+		w.Header().Set("Access-Control-Allow-Methods", "PUT, DELETE")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	h := newTestServer(t,
+		"-rootdir", writeTree(t, "index.html"),
+		"-cors-origins", "https://app.example",
+		"-proxy", "/api="+upstream.URL,
+	).Handler
+
+	preflight := func(path, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("OPTIONS", path, nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("/some/route", "https://app.example")
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("preflight: got %d with %q, want an empty 204, not the index", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("preflight: Access-Control-Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "POST" {
+		t.Errorf("preflight: Access-Control-Allow-Methods = %q, want POST", got)
+	}
+
+	w = preflight("/some/route", "https://evil.example")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("preflight from another origin: Access-Control-Allow-Origin = %q", got)
+	}
+
+	// proxied paths leave preflights to their backend
+	w = preflight("/api/items", "https://app.example")
+	if backendMethod != "OPTIONS" || w.Code != http.StatusOK {
+		t.Errorf("proxied preflight: backend saw %q, client got %d", backendMethod, w.Code)
+	}
+	if got := w.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 {
+		t.Errorf("proxied preflight: Access-Control-Allow-Origin %q, want the backend's alone", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "PUT, DELETE" || w.Header().Get("Allow") != "" {
+		t.Errorf("proxied preflight: Access-Control-Allow-Methods %q, Allow %q, want the backend's", got, w.Header().Get("Allow"))
+	}
+
+	// actual requests still reach the app
+	r := httptest.NewRequest("GET", "/some/route", nil)
+	r.Header.Set("Origin", "https://app.example")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "index.html" {
+		t.Errorf("GET: got %d %q, want the index", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("GET: Access-Control-Allow-Origin = %q", got)
+	}
+}
+
+func TestPreflightProxyHost(t *testing.T) {
+	captureLog(t)
+	var backendMethod string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendMethod = r.Method
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	h := newTestServer(t,
+		"-rootdir", writeTree(t, "index.html"),
+		"-proxy-host", "api.example.com="+upstream.URL,
+	).Handler
+
+	r := httptest.NewRequest("OPTIONS", "/items", nil)
+	r.Host = "api.example.com"
+	r.Header.Set("Origin", "https://app.example")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if backendMethod != "OPTIONS" || w.Code != http.StatusOK || w.Header().Get("Allow") != "" {
+		t.Errorf("backend saw %q, client got %d with Allow %q", backendMethod, w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestCORS(t *testing.T) {
+	captureLog(t)
+	root := writeTree(t, "index.html")
+	fetch := func(h http.Handler, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	h := newTestServer(t, "-rootdir", root, "-cors-origins", "https://app.example, https://admin.example").Handler
+	for _, origin := range []string{"https://app.example", "https://admin.example"} {
+		w := fetch(h, origin)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q", origin, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q without -cors-credentials", origin, got)
+		}
+	}
+	w := fetch(h, "https://evil.example")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin: Access-Control-Allow-Origin = %q", got)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "index.html" {
+		t.Errorf("disallowed origin: got %d %q, want the page without CORS headers", w.Code, w.Body.String())
+	}
+
+	h = newTestServer(t,
+		"-rootdir", root,
+		"-cors-origins", "https://app.example",
+		"-cors-methods", "GET,PUT",
+		"-cors-headers", "X-Token",
+		"-cors-credentials",
+	).Handler
+	w = fetch(h, "https://app.example")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("credentials: Access-Control-Allow-Origin = %q, want the origin itself", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("credentials: Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://app.example")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Access-Control-Request-Headers", "X-Token")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "PUT" {
+		t.Errorf("preflight: Access-Control-Allow-Methods = %q, want PUT", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "X-Token" {
+		t.Errorf("preflight: Access-Control-Allow-Headers = %q, want X-Token", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("preflight: Access-Control-Allow-Credentials = %q, want true", got)
+	}
+}
+
+func TestCORSCredentialsNeedOrigins(t *testing.T) {
+	captureLog(t)
+	for _, origins := range []string{"", "*"} {
+		if _, err := corsOptions(CmdLineArgs{CORSOrigins: origins, CORSCreds: true}); err == nil {
+			t.Errorf("-cors-credentials with -cors-origins %q accepted", origins)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// hasControlChars reports whether s contains a null byte or any other
+// ASCII control character.
+func hasControlChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectControlChars responds with 400 to requests whose decoded path
+// contains control characters, which no legitimate asset name has and
+// which often signal traversal or injection attempts.
+func rejectControlChars(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasControlChars(r.URL.Path) {
+			badRequest(w, r, "invalid_characters", "invalid characters in path")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isWithin reports whether target lies inside the root directory.
+func isWithin(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveWithin cleans the URL path p and joins it onto root, reporting
+// false if the result would fall outside of root. Cleaning alone isn't
+// enough where the OS has other separators than "/", so the result is
+// checked with filepath.Rel as well.
+func resolveWithin(root, p string) (string, bool) {
+	full := filepath.Join(root, filepath.FromSlash(path.Clean("/"+p)))
+	if !isWithin(root, full) {
+		return "", false
+	}
+	return full, true
+}
+
+// resolvesWithin reports whether target, once all symlinks are
+// followed, still lies inside root.
+func resolvesWithin(root, target string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	realTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return false
+	}
+	return isWithin(realRoot, realTarget)
+}
+
+// hasPathPrefix reports whether the URL path p is prefix itself or lies
+// beneath it, so that /api matches /api and /api/users but not /apis.
+func hasPathPrefix(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestRejectControlChars(t *testing.T) {
+	h := rejectControlChars(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/app.js", http.StatusOK},
+		{"/caf%C3%A9.png", http.StatusOK},
+		{"/index.html%00.js", http.StatusBadRequest},
+		{"/a%0Ab", http.StatusBadRequest},
+		{"/a%7Fb", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL = u
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+func TestResolveWithin(t *testing.T) {
+	root := filepath.FromSlash("/srv/www")
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/app.js", "/srv/www/app.js", true},
+		{"/a/../b.js", "/srv/www/b.js", true},
+		{"/../../etc/passwd", "/srv/www/etc/passwd", true},
+		{"..", "/srv/www", true},
+	}
+	for _, tt := range tests {
+		got, ok := resolveWithin(root, tt.path)
+		if ok != tt.ok || got != filepath.FromSlash(tt.want) {
+			t.Errorf("resolveWithin(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+	if isWithin(root, filepath.FromSlash("/srv/www-other/x")) {
+		t.Error("a sibling with a common prefix counted as within the root")
+	}
+}
+
+func TestTraversalRejected(t *testing.T) {
+	outside := writeTree(t, "secret.txt")
+	root := writeTree(t, "index.html")
+	h := spaHandler{staticPath: root, indexPath: "index.html"}
+	rel, err := filepath.Rel(root, filepath.Join(outside, "secret.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.URL.Path = "/" + filepath.ToSlash(rel)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.String() == "secret.txt" {
+		t.Errorf("%s served a file outside the root", r.URL.Path)
+	}
+}
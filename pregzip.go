@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isCompressibleType reports whether content of the given type is text
+// that is worth compressing.
+func isCompressibleType(typ string) bool {
+	mediaType, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml",
+		"application/manifest+json", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// gzippedFile is the precompressed form of a file on disk.
+type gzippedFile struct {
+	body    []byte
+	modTime time.Time
+}
+
+// gzipStore holds gzipped copies of the text assets in a directory,
+// built once at startup, keyed by file path.
+type gzipStore map[string]gzippedFile
+
+// newGzipStore compresses every compressible file under root.
+func newGzipStore(root string) (gzipStore, error) {
+	store := gzipStore{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || isFont(path) ||
+			!isCompressibleType(mime.TypeByExtension(filepath.Ext(path))) {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		gz.Write(src)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		store[path] = gzippedFile{body: buf.Bytes(), modTime: info.ModTime()}
+		return nil
+	})
+	return store, err
+}
+
+// serve serves the gzipped copy of the file at path if there is an
+// up-to-date one and the client accepts gzip, reporting whether it did.
+func (s gzipStore) serve(w http.ResponseWriter, r *http.Request, path string, info os.FileInfo) bool {
+	f, ok := s[path]
+	if !ok || !f.modTime.Equal(info.ModTime()) {
+		return false
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r) {
+		return false
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(path)))
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	http.ServeContent(w, r, path, f.modTime, bytes.NewReader(f.body))
+	return true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGzipStore(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js", "logo.png", "fonts/inter.woff2")
+	store, err := newGzipStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "app.js"} {
+		if _, ok := store[filepath.Join(root, name)]; !ok {
+			t.Errorf("%s was not compressed", name)
+		}
+	}
+	for _, name := range []string{"logo.png", "fonts/inter.woff2"} {
+		if _, ok := store[filepath.Join(root, filepath.FromSlash(name))]; ok {
+			t.Errorf("%s was compressed", name)
+		}
+	}
+
+	h := spaHandler{staticPath: root, indexPath: "index.html", gzipped: store}
+	r := httptest.NewRequest("GET", "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(zr); string(body) != "app.js" {
+		t.Errorf("decompressed body = %q", body)
+	}
+
+	// a file changed since startup is served from disk
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "app.js"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "app.js" {
+		t.Errorf("stale copy served with Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+}
+
+// BenchmarkPregzip serves a text asset gzipped from memory, compressed
+// on the fly, and uncompressed from disk.
+func BenchmarkPregzip(b *testing.B) {
+	root := b.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "app.js"), []byte(testPage), 0644); err != nil {
+		b.Fatal(err)
+	}
+	store, err := newGzipStore(root)
+	if err != nil {
+		b.Fatal(err)
+	}
+	disk := spaHandler{staticPath: root, indexPath: "index.html"}
+	handlers := map[string]http.Handler{
+		"memory":   spaHandler{staticPath: root, indexPath: "index.html", gzipped: store},
+		"onthefly": gzipHandler(0, nil, nil, false, disk),
+		"disk":     disk,
+	}
+	for _, name := range []string{"memory", "onthefly", "disk"} {
+		h := handlers[name]
+		b.Run(name, func(b *testing.B) {
+			r := httptest.NewRequest("GET", "/app.js", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hostProxyFlag collects repeated -proxy-host flags of the form
+// host=upstream[,upstream...], mapping a request Host to the backends it
+// is proxied to.
+type hostProxyFlag map[string][]*url.URL
+
+func (f hostProxyFlag) String() string {
+	hosts := make([]string, 0, len(f))
+	for host, targets := range f {
+		hosts = append(hosts, host+"="+joinURLs(targets))
+	}
+	sort.Strings(hosts)
+	return strings.Join(hosts, " ")
+}
+
+func (f hostProxyFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected host=upstream, got %q", value)
+	}
+	targets, err := parseUpstreams(parts[1])
+	if err != nil {
+		return err
+	}
+	f[strings.ToLower(parts[0])] = targets
+	return nil
+}
+
+// pathProxyFlag collects repeated -proxy flags of the form
+// /prefix=upstream[,upstream...], mapping a path prefix to the backends
+// requests under it are proxied to.
+type pathProxyFlag map[string][]*url.URL
+
+func (f pathProxyFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for _, prefix := range f.prefixes() {
+		pairs = append(pairs, prefix+"="+joinURLs(f[prefix]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func (f pathProxyFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") || parts[0] == "/" {
+		return fmt.Errorf("expected /prefix=upstream, got %q", value)
+	}
+	targets, err := parseUpstreams(parts[1])
+	if err != nil {
+		return err
+	}
+	f[strings.TrimSuffix(parts[0], "/")] = targets
+	return nil
+}
+
+// prefixes returns the proxied prefixes, longest first.
+func (f pathProxyFlag) prefixes() []string {
+	prefixes := make([]string, 0, len(f))
+	for prefix := range f {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+	return prefixes
+}
+
+// parseUpstreams parses a comma-separated list of backend URLs.
+func parseUpstreams(value string) ([]*url.URL, error) {
+	var targets []*url.URL
+	for _, raw := range strings.Split(value, ",") {
+		target, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		if target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("upstream %q must be an absolute URL", raw)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func joinURLs(urls []*url.URL) string {
+	strs := make([]string, len(urls))
+	for i, u := range urls {
+		strs[i] = u.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// requestHost returns the host the request was addressed to, without
+// any port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// proxyOptions configures the reverse proxies created by newProxy.
+type proxyOptions struct {
+	// cacheTTL, if positive, caches cacheable GET responses for up to
+	// this long
+	cacheTTL time.Duration
+	// random picks upstreams at random rather than round-robin
+	random bool
+	// cooldown is how long an unreachable upstream is skipped for
+	cooldown time.Duration
+	// forwardHeaders are correlation headers always passed upstream
+	forwardHeaders []string
+	// gzipJSON compresses uncompressed JSON responses for clients
+	// that accept gzip
+	gzipJSON bool
+	// retries is how many times a failed idempotent request is
+	// retried, waiting retryBackoff in between
+	retries      int
+	retryBackoff time.Duration
+	// breakerThreshold, if positive, is how many failures within
+	// breakerWindow open the circuit for breakerCooldown
+	breakerThreshold int
+	breakerWindow    time.Duration
+	breakerCooldown  time.Duration
+	// retryAfter is the hint sent with 503s and with 502s when no
+	// backend could be reached
+	retryAfter time.Duration
+	// expectContinue is how long to wait for a backend's 100 Continue
+	// before sending the body of a request that expects one
+	expectContinue time.Duration
+	// debugBodies, if set, logs a sample of request and response bodies
+	debugBodies *bodyLogger
+	// rewrites maps public path prefixes to the backend's
+	rewrites pathRewriteFlag
+	// errorPage, if set, replaces the body of backend 5xx responses
+	errorPage *proxyErrorPage
+	// onUnreachable, if set, is called for every request no backend
+	// could answer
+	onUnreachable func()
+}
+
+// newProxy returns a handler that proxies requests across targets.
+func newProxy(targets []*url.URL, opts proxyOptions) http.Handler {
+	b := newBalancer(targets, opts.random, opts.cooldown)
+	// Expect: 100-continue is forwarded to the backend, which decides
+	// whether the client should send its body. Its 100 response is
+	// relayed to the client, so the body is streamed, not buffered.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = opts.expectContinue
+
+	rp := &httputil.ReverseProxy{
+		Transport: transport,
+		Director: func(req *http.Request) {
+			opts.rewrites.rewrite(req)
+			b.pick().direct(req)
+			forwardCorrelation(req, opts.forwardHeaders)
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("proxy error for %s: %v\n", req.URL.Host, err)
+			b.markDown(req.URL.Host)
+			if opts.onUnreachable != nil {
+				opts.onUnreachable()
+			}
+			badGateway(w, req, opts.errorPage, opts.retryAfter)
+		},
+	}
+	rp.ModifyResponse = func(resp *http.Response) error {
+		if opts.errorPage != nil {
+			if err := opts.errorPage.modifyResponse(resp); err != nil {
+				return err
+			}
+		}
+		if opts.gzipJSON {
+			return gzipJSONResponse(resp)
+		}
+		return nil
+	}
+	if opts.retries > 0 {
+		rp.Transport = &retryTransport{
+			base:    transport,
+			b:       b,
+			retries: opts.retries,
+			backoff: opts.retryBackoff,
+		}
+	}
+
+	var proxy http.Handler = rp
+	if opts.breakerThreshold > 0 {
+		cb := newCircuitBreaker(opts.breakerThreshold, opts.breakerWindow, opts.breakerCooldown)
+		proxy = cb.wrap(opts.retryAfter, proxy)
+	}
+	if opts.debugBodies != nil {
+		proxy = opts.debugBodies.wrap(proxy)
+	}
+	if opts.cacheTTL > 0 {
+		proxy = newResponseCache(opts.cacheTTL).wrap(proxy)
+	}
+	return proxy
+}
+
+// hostProxy sends requests whose Host has a mapping to the matching
+// backend and everything else to next.
+func hostProxy(targets hostProxyFlag, opts proxyOptions, next http.Handler) http.Handler {
+	proxies := make(map[string]http.Handler, len(targets))
+	for host, upstreams := range targets {
+		proxies[host] = newProxy(upstreams, opts)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if proxy, ok := proxies[requestHost(r)]; ok {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
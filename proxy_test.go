@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backend starts a server answering every request with body.
+func backend(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHostProxyFlag(t *testing.T) {
+	f := hostProxyFlag{}
+	if err := f.Set("API.example.com=http://127.0.0.1:8081,http://127.0.0.1:8082"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f["api.example.com"]); got != 2 {
+		t.Errorf("api.example.com has %d upstreams, want 2", got)
+	}
+	for _, bad := range []string{"api.example.com", "=http://a", "api.example.com=/relative"} {
+		if err := (hostProxyFlag{}).Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+}
+
+func TestHostProxy(t *testing.T) {
+	api := backend(t, "api")
+	targets := hostProxyFlag{}
+	if err := targets.Set("api.example.com=" + api.URL); err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("spa"))
+	})
+	h := hostProxy(targets, proxyOptions{}, next)
+
+	tests := []struct {
+		host, want string
+	}{
+		{"api.example.com", "api"},
+		{"API.example.com:443", "api"},
+		{"www.example.com", "spa"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if body, _ := ioutil.ReadAll(w.Body); string(body) != tt.want {
+			t.Errorf("Host %s: got %q, want %q", tt.host, body, tt.want)
+		}
+	}
+}
+
+func TestProxyExpectContinue(t *testing.T) {
+	var expect string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect = r.Header.Get("Expect")
+		if strings.HasSuffix(r.URL.Path, "/reject") {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer upstream.Close()
+	targets, err := parseUpstreams(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	fronts := map[string]http.Handler{
+		"proxy": newProxy(targets, proxyOptions{expectContinue: time.Second}),
+		// the whole stack, whose compression and logging wrap the proxy
+		"server": newTestServer(t,
+			"-rootdir", writeTree(t, "index.html"),
+			"-proxy", "/api="+upstream.URL,
+			"-proxy-expect-continue-timeout", "1s",
+			"-log-format", "json",
+		).Handler,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = 5 * time.Second
+	client := &http.Client{Transport: transport}
+	for _, name := range []string{"proxy", "server"} {
+		front := httptest.NewServer(fronts[name])
+		for _, tt := range []struct {
+			path   string
+			status int
+			got100 bool
+		}{
+			{"/api/upload", http.StatusCreated, true},
+			{"/api/reject", http.StatusRequestEntityTooLarge, false},
+		} {
+			var got100 bool
+			trace := &httptrace.ClientTrace{Got100Continue: func() { got100 = true }}
+			req, _ := http.NewRequest("POST", front.URL+tt.path, strings.NewReader("payload"))
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+			req.Header.Set("Expect", "100-continue")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("%s %s: status = %d, want %d", name, tt.path, resp.StatusCode, tt.status)
+			}
+			if got100 != tt.got100 {
+				t.Errorf("%s %s: got 100 Continue = %v, want %v", name, tt.path, got100, tt.got100)
+			}
+			if tt.status == http.StatusCreated && string(body) != "payload" {
+				t.Errorf("%s %s: upstream got %q", name, tt.path, body)
+			}
+			if expect != "100-continue" {
+				t.Errorf("%s %s: upstream saw Expect %q", name, tt.path, expect)
+			}
+		}
+		front.Close()
+	}
+}
+
+func TestPathProxyFlag(t *testing.T) {
+	f := pathProxyFlag{}
+	for _, value := range []string{
+		"/api/=http://127.0.0.1:8081",
+		"/api/v2=http://127.0.0.1:8082,http://127.0.0.1:8083",
+		"/auth=http://127.0.0.1:8084",
+	} {
+		if err := f.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(f["/api/v2"]); got != 2 {
+		t.Errorf("/api/v2 has %d upstreams, want 2", got)
+	}
+	want := []string{"/api/v2", "/auth", "/api"}
+	if got := f.prefixes(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("prefixes() = %v, want %v", got, want)
+	}
+	for _, bad := range []string{"/=http://a", "api=http://a", "/api", "/api=relative"} {
+		if err := (pathProxyFlag{}).Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+}
+
+func TestProxyUnreachable(t *testing.T) {
+	targets, err := parseUpstreams(deadUpstream(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unreachable int
+	h := newProxy(targets, proxyOptions{
+		retryAfter:    5 * time.Second,
+		onUnreachable: func() { unreachable++ },
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("status = %d, want 502", w.Code)
+		}
+		if strings.Contains(w.Body.String(), "connection refused") {
+			t.Errorf("502 shows the transport error: %q", w.Body.String())
+		}
+		if got := w.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("Retry-After = %q, want 5", got)
+		}
+	}
+	if unreachable != 2 {
+		t.Errorf("counted %d unreachable requests, want 2", unreachable)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// proxyErrorPage replaces the body of 5xx responses from proxied backends
+// with a static page, keeping their status.
+type proxyErrorPage struct {
+	body []byte
+}
+
+// newProxyErrorPage reads the HTML page served for backend 5xx responses.
+func newProxyErrorPage(path string) (*proxyErrorPage, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyErrorPage{body: body}, nil
+}
+
+// content returns the body and type of an error response with status:
+// the page, or a JSON error if the client asked for JSON.
+func (p *proxyErrorPage) content(r *http.Request, status int, code string) ([]byte, string, error) {
+	if !acceptsJSON(r) {
+		return p.body, "text/html; charset=utf-8", nil
+	}
+	body, err := json.Marshal(jsonError{
+		Error: http.StatusText(status),
+		Code:  code,
+		Path:  r.URL.Path,
+	})
+	return body, "application/json", err
+}
+
+// modifyResponse swaps the body of a 5xx response for the page, or for a
+// JSON error if the client asked for JSON.
+func (p *proxyErrorPage) modifyResponse(resp *http.Response) error {
+	if resp.StatusCode < 500 || resp.StatusCode > 599 {
+		return nil
+	}
+	body, typ, err := p.content(resp.Request, resp.StatusCode, "upstream_error")
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	for _, name := range []string{"Content-Encoding", "ETag", "Last-Modified", "Content-Range"} {
+		resp.Header.Del(name)
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Content-Type", typ)
+	resp.Header.Set("Cache-Control", "no-store")
+	resp.Header.Add("Vary", "Accept")
+	return nil
+}
+
+// badGateway responds with a 502 for a request no backend could answer.
+// The body is the error page if there is one, and otherwise a JSON or
+// plain text error; the transport's error is never shown to the client.
+// If retryAfter is positive, a Retry-After header tells clients when to
+// come back.
+func badGateway(w http.ResponseWriter, r *http.Request, page *proxyErrorPage, retryAfter time.Duration) {
+	h := w.Header()
+	setRetryAfter(h, retryAfter)
+	h.Set("Cache-Control", "no-store")
+	if page != nil {
+		body, typ, err := page.content(r, http.StatusBadGateway, "upstream_unreachable")
+		if err == nil {
+			h.Set("Content-Type", typ)
+			h.Set("Content-Length", strconv.Itoa(len(body)))
+			h.Add("Vary", "Accept")
+			w.WriteHeader(http.StatusBadGateway)
+			if r.Method != http.MethodHead {
+				w.Write(body)
+			}
+			return
+		}
+	}
+	if acceptsJSON(r) {
+		writeJSONError(w, http.StatusBadGateway, jsonError{
+			Error: http.StatusText(http.StatusBadGateway),
+			Code:  "upstream_unreachable",
+			Path:  r.URL.Path,
+		})
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
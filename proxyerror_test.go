@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyErrorPage(t *testing.T) {
+	page := &proxyErrorPage{body: []byte("<h1>down</h1>")}
+	respond := func(status int, accept string) *http.Response {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/api/users", nil)
+		r.Header.Set("Accept", accept)
+		resp := &http.Response{
+			StatusCode: status,
+			Header: http.Header{
+				"Etag":             {`"abc"`},
+				"Content-Encoding": {"gzip"},
+			},
+			Body:    ioutil.NopCloser(strings.NewReader("upstream body")),
+			Request: r,
+		}
+		if err := page.modifyResponse(resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := respond(http.StatusServiceUnavailable, "text/html")
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "<h1>down</h1>" || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("5xx: got %d %q, want the page with the status kept", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") != "" || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("5xx kept the backend's validators: %v", resp.Header)
+	}
+	if resp.ContentLength != int64(len(body)) || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("5xx: length %d, Cache-Control %q", resp.ContentLength, resp.Header.Get("Cache-Control"))
+	}
+
+	resp = respond(http.StatusBadGateway, "application/json")
+	var got jsonError
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != "upstream_error" || got.Path != "/api/users" {
+		t.Errorf("JSON 5xx: got %+v", got)
+	}
+
+	resp = respond(http.StatusNotFound, "text/html")
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "upstream body" {
+		t.Errorf("404: got %q, want the backend's body", body)
+	}
+}
+
+func TestBadGateway(t *testing.T) {
+	page := &proxyErrorPage{body: []byte("<h1>down</h1>")}
+	tests := []struct {
+		name   string
+		page   *proxyErrorPage
+		accept string
+		method string
+		want   string
+	}{
+		{"page", page, "text/html", "GET", "<h1>down</h1>"},
+		{"page HEAD", page, "text/html", "HEAD", ""},
+		{"json", nil, "application/json", "GET", `"code":"upstream_unreachable"`},
+		{"text", nil, "text/html", "GET", "Bad Gateway"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api", nil)
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		badGateway(w, r, tt.page, 1500*time.Millisecond)
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s: status = %d, want 502", tt.name, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != "2" {
+			t.Errorf("%s: Retry-After = %q, want 2", tt.name, got)
+		}
+		if !strings.Contains(w.Body.String(), tt.want) || (tt.want == "" && w.Body.Len() != 0) {
+			t.Errorf("%s: body %q, want %q", tt.name, w.Body.String(), tt.want)
+		}
+	}
+}
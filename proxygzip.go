@@ -0,0 +1,44 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// gzipJSONResponse compresses an uncompressed JSON response from a
+// proxied backend on its way to a client that accepts gzip. The body is
+// compressed as it streams through, not buffered.
+func gzipJSONResponse(resp *http.Response) error {
+	if resp.Request.Method == http.MethodHead ||
+		resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified ||
+		resp.Header.Get("Content-Encoding") != "" ||
+		!acceptsGzip(resp.Request) {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return nil
+	}
+
+	body := resp.Body
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, body)
+		if err == nil {
+			err = gz.Close()
+		}
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+
+	resp.Body = pr
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.Header.Add("Vary", "Accept-Encoding")
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyGzipJSON(t *testing.T) {
+	payload := `{"items":[` + strings.Repeat(`{"id":1},`, 100) + `{"id":2}]}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".txt") {
+			w.Header().Set("Content-Type", "text/plain")
+		} else {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+		w.Write([]byte(payload))
+	}))
+	defer upstream.Close()
+	targets, err := parseUpstreams(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newProxy(targets, proxyOptions{gzipJSON: true})
+
+	r := httptest.NewRequest("GET", "/api/items", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(zr); string(body) != payload {
+		t.Error("decompressed body differs from the upstream's")
+	}
+
+	tests := []struct {
+		path, accept string
+	}{
+		{"/api/items", ""},
+		{"/api/notes.txt", "gzip"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept-Encoding", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != payload {
+			t.Errorf("%s with Accept-Encoding %q: compressed", tt.path, tt.accept)
+		}
+	}
+}
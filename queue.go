@@ -0,0 +1,93 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// fairQueue limits how many requests are handled at once. Requests over
+// the limit wait in a bounded FIFO queue and are let in strictly in
+// arrival order; when the queue is full they are turned away.
+type fairQueue struct {
+	limit    int
+	maxQueue int
+
+	mu      sync.Mutex
+	active  int
+	waiting *list.List // of chan struct{}
+}
+
+func newFairQueue(limit, maxQueue int) *fairQueue {
+	return &fairQueue{
+		limit:    limit,
+		maxQueue: maxQueue,
+		waiting:  list.New(),
+	}
+}
+
+// acquire takes a slot, waiting its turn if necessary. It returns false
+// if the queue is full or done is closed before a slot was handed over.
+func (q *fairQueue) acquire(done <-chan struct{}) bool {
+	q.mu.Lock()
+	if q.active < q.limit && q.waiting.Len() == 0 {
+		q.active++
+		q.mu.Unlock()
+		return true
+	}
+	if q.waiting.Len() >= q.maxQueue {
+		q.mu.Unlock()
+		return false
+	}
+	turn := make(chan struct{})
+	elem := q.waiting.PushBack(turn)
+	q.mu.Unlock()
+
+	select {
+	case <-turn:
+		return true
+	case <-done:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-turn:
+			// the slot was handed over just as we gave up, pass it on
+			q.handOff()
+		default:
+			q.waiting.Remove(elem)
+		}
+		return false
+	}
+}
+
+// release gives up a slot, handing it to the longest waiting request.
+func (q *fairQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handOff()
+}
+
+// handOff passes the caller's slot to the next in line, or frees it.
+// It must be called with q.mu held.
+func (q *fairQueue) handOff() {
+	if front := q.waiting.Front(); front != nil {
+		q.waiting.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	q.active--
+}
+
+// limitConcurrency wraps a handler so that at most the queue's limit of
+// requests run at once, responding 503 to requests that can't be queued.
+func limitConcurrency(q *fairQueue, retryAfter time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !q.acquire(r.Context().Done()) {
+			serviceUnavailable(w, retryAfter)
+			return
+		}
+		defer q.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// queued reports how many requests are waiting in q.
+func queued(q *fairQueue) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting.Len()
+}
+
+func waitQueued(t *testing.T, q *fairQueue, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); queued(q) != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued, want %d", queued(q), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFairQueueOrder(t *testing.T) {
+	q := newFairQueue(1, 2)
+	if !q.acquire(nil) {
+		t.Fatal("first acquire failed")
+	}
+
+	order := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		go func(i int) {
+			if q.acquire(nil) {
+				order <- i
+			}
+		}(i)
+		waitQueued(t, q, i)
+	}
+	if q.acquire(nil) {
+		t.Error("acquired with the queue full")
+	}
+
+	for want := 1; want <= 2; want++ {
+		q.release()
+		if got := <-order; got != want {
+			t.Errorf("request %d let in, want %d", got, want)
+		}
+	}
+	q.release()
+	if q.active != 0 {
+		t.Errorf("%d slots still active", q.active)
+	}
+}
+
+func TestFairQueueGiveUp(t *testing.T) {
+	q := newFairQueue(1, 1)
+	q.acquire(nil)
+	done := make(chan struct{})
+	result := make(chan bool)
+	go func() { result <- q.acquire(done) }()
+	waitQueued(t, q, 1)
+	close(done)
+	if <-result {
+		t.Error("acquired after giving up")
+	}
+	if queued(q) != 0 {
+		t.Error("request still queued after giving up")
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	q := newFairQueue(1, 0)
+	q.acquire(nil)
+	h := limitConcurrency(q, 3*time.Second, http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "3" {
+		t.Errorf("got %d with Retry-After %q, want a 503 with 3", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "net/http"
+
+// noRangesWriter advertises that the response doesn't support ranges,
+// overriding the Accept-Ranges: bytes that http.ServeContent sets.
+type noRangesWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *noRangesWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Accept-Ranges", "none")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *noRangesWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// disableRanges makes requests for paths under any of the prefixes
+// ignore Range headers, always getting the full body with a 200.
+func disableRanges(prefixes []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range prefixes {
+			if hasPathPrefix(r.URL.Path, prefix) {
+				r.Header.Del("Range")
+				r.Header.Del("If-Range")
+				w = &noRangesWriter{ResponseWriter: w}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisableRanges(t *testing.T) {
+	h := disableRanges([]string{"/video"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "clip.bin", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	tests := []struct {
+		path   string
+		status int
+		ranges string
+	}{
+		{"/video/clip.bin", http.StatusOK, "none"},
+		{"/video", http.StatusOK, "none"},
+		{"/videos/clip.bin", http.StatusPartialContent, "bytes"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Range", "bytes=0-3")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status || w.Header().Get("Accept-Ranges") != tt.ranges {
+			t.Errorf("%s: got %d with Accept-Ranges %q, want %d with %q",
+				tt.path, w.Code, w.Header().Get("Accept-Ranges"), tt.status, tt.ranges)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateSweepInterval is how often clients idle long enough to have a full
+// bucket again are forgotten.
+const rateSweepInterval = time.Minute
+
+// tokenBucket holds a client's tokens as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter gives every client a token bucket that refills at rate
+// tokens a second up to burst. Each request takes a token.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	trusted ipAllowlist
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter returns a limiter for rate requests a second with
+// bursts of up to burst. X-Forwarded-For is only believed from trusted
+// proxies.
+func newRateLimiter(rate float64, burst int, trusted ipAllowlist) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		trusted: trusted,
+		buckets: map[string]*tokenBucket{},
+	}
+	go func() {
+		for now := range time.Tick(rateSweepInterval) {
+			l.sweep(now)
+		}
+	}()
+	return l
+}
+
+// take spends one of the client's tokens at now. If none is left, it
+// returns how long until one will be.
+func (l *rateLimiter) take(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep forgets clients whose buckets have refilled by now, since a new
+// bucket would be no different.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientIP returns the address the limit is kept against: the peer, or,
+// if the peer is a trusted proxy, the nearest untrusted address in
+// X-Forwarded-For.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if ip == nil {
+		return r.RemoteAddr
+	}
+	if !l.trusted.allows(r) {
+		return ip.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !l.trusted.contains(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// limit answers clients that have run out of tokens with a 429.
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.take(l.clientIP(r), time.Now())
+		if !ok {
+			setRetryAfter(w.Header(), wait)
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	l := &rateLimiter{rate: 2, burst: 3, buckets: map[string]*tokenBucket{}}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.take("a", now); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.take("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("past the burst: ok %v, wait %v, want a 500ms wait", ok, wait)
+	}
+	if ok, _ := l.take("b", now); !ok {
+		t.Error("another client shares the first one's bucket")
+	}
+	if ok, _ := l.take("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("the bucket did not refill")
+	}
+
+	l.sweep(now.Add(time.Second))
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("sweep kept a refilled bucket")
+	}
+	if _, ok := l.buckets["a"]; !ok {
+		t.Error("sweep dropped a bucket still refilling")
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	trusted, err := parseIPAllowlist("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &rateLimiter{trusted: trusted}
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		{"8.8.8.8:1234", "1.2.3.4", "8.8.8.8"},
+		{"10.0.0.1:1234", "1.2.3.4", "1.2.3.4"},
+		{"10.0.0.1:1234", "1.2.3.4, 5.6.7.8, 10.0.0.2", "5.6.7.8"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "garbage", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := l.clientIP(r); got != tt.want {
+			t.Errorf("%s via %q: clientIP = %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := &rateLimiter{rate: 1, burst: 1, buckets: map[string]*tokenBucket{}}
+	h := l.limit(http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("second request: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
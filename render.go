@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// indexTransform rewrites the contents of an index file.
+type indexTransform func(src []byte) ([]byte, error)
+
+// renderedIndex is an index file as rewritten by an indexRenderer.
+type renderedIndex struct {
+	body    []byte
+	etag    string
+	modTime time.Time
+	size    int64
+}
+
+// indexRenderer serves index files from memory, rewritten by its
+// transforms in order. The rendered copy of each file is kept until the
+// file's mtime or size changes; the file on disk is never touched.
+// Concurrent requests that find the copy stale share a single re-read, so
+// a burst of traffic during a deploy reads the new file once.
+type indexRenderer struct {
+	transforms []indexTransform
+	// noCache renders the file afresh for every request
+	noCache bool
+
+	mu       sync.Mutex
+	rendered map[string]*renderedIndex
+	inFlight singleflight.Group
+}
+
+func newIndexRenderer(noCache bool, transforms ...indexTransform) *indexRenderer {
+	return &indexRenderer{
+		transforms: transforms,
+		noCache:    noCache,
+		rendered:   make(map[string]*renderedIndex),
+	}
+}
+
+// rewrites reports whether the renderer changes the files it serves.
+func (ir *indexRenderer) rewrites() bool {
+	return len(ir.transforms) > 0
+}
+
+// render returns the rewritten index at path.
+func (ir *indexRenderer) render(path string) (*renderedIndex, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if ir.noCache {
+		return ir.load(path, info)
+	}
+
+	ir.mu.Lock()
+	cached, ok := ir.rendered[path]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		ir.mu.Unlock()
+		return cached, nil
+	}
+	ir.mu.Unlock()
+
+	// a panicking transform reaches every waiting request, rather than
+	// leaving them blocked
+	v, err, _ := ir.inFlight.Do(path, func() (interface{}, error) {
+		rendered, err := ir.load(path, info)
+		if err != nil {
+			return nil, err
+		}
+		ir.mu.Lock()
+		ir.rendered[path] = rendered
+		ir.mu.Unlock()
+		return rendered, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*renderedIndex), nil
+}
+
+// load reads and rewrites the index at path, described by info.
+func (ir *indexRenderer) load(path string, info os.FileInfo) (*renderedIndex, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, transform := range ir.transforms {
+		if body, err = transform(body); err != nil {
+			return nil, err
+		}
+	}
+	return &renderedIndex{
+		body:    body,
+		etag:    strongETag(body),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
+
+// serve responds with the rendered index at path.
+func (ir *indexRenderer) serve(w http.ResponseWriter, r *http.Request, path string) {
+	rendered, err := ir.render(path)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", rendered.etag)
+	http.ServeContent(w, r, path, rendered.modTime, bytes.NewReader(rendered.body))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIndexRendererCaches(t *testing.T) {
+	path := filepath.Join(writeTree(t, "index.html"), "index.html")
+	var calls int32
+	ir := newIndexRenderer(false, func(src []byte) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return bytes.ToUpper(src), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rendered, err := ir.render(path)
+			if err != nil {
+				t.Error(err)
+			} else if string(rendered.body) != "INDEX.HTML" {
+				t.Errorf("body = %q", rendered.body)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("rendered %d times, want once", calls)
+	}
+
+	// a new file is rendered afresh
+	if err := ioutil.WriteFile(path, []byte("new index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := ir.render(path)
+	if err != nil || string(rendered.body) != "NEW INDEX" {
+		t.Errorf("after a deploy got %q, %v", rendered.body, err)
+	}
+}
+
+func TestIndexRendererSurvivesPanic(t *testing.T) {
+	path := filepath.Join(writeTree(t, "index.html"), "index.html")
+	panicking := true
+	ir := newIndexRenderer(false, func(src []byte) ([]byte, error) {
+		if panicking {
+			panic("bad transform")
+		}
+		return src, nil
+	})
+
+	func() {
+		defer func() { recover() }()
+		ir.render(path)
+		t.Error("render did not panic")
+	}()
+
+	panicking = false
+	done := make(chan error)
+	go func() {
+		_, err := ir.render(path)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("render blocked after a panicking transform")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/foomo/simplecert"
+)
+
+// certConfig builds the simplecert configuration for -ssl from args,
+// leaving the renewal callbacks to the caller.
+func certConfig(args CmdLineArgs) (*simplecert.Config, error) {
+	if args.RenewCheck <= 0 {
+		return nil, errors.New("renewal check interval must be positive")
+	}
+	cfg := *simplecert.Default
+	cfg.Domains = []string{args.Domain}
+	cfg.CacheDir = args.CertCache
+	cfg.SSLEmail = args.SSLEmail
+	cfg.CheckInterval = args.RenewCheck
+	// the ACME challenge is answered on the TLS port, and plain HTTP is
+	// left to servePlain
+	cfg.HTTPAddress = ""
+	return &cfg, nil
+}
+
+// liveServer is the server answering requests. With -ssl, simplecert
+// answers the ACME challenge on the server's port itself, so the server
+// stops for each certificate renewal and a new one starts afterwards. A
+// stop signal has to reach whichever server is live, and once shutdown
+// has begun no renewal may start another.
+type liveServer struct {
+	// wait is how long requests get to finish when a renewal stops the
+	// server
+	wait time.Duration
+	// restart builds and starts the server that replaces the stopped one
+	restart func() *http.Server
+
+	mu           sync.Mutex
+	srv          *http.Server
+	shuttingDown bool
+}
+
+func newLiveServer(srv *http.Server, wait time.Duration, restart func() *http.Server) *liveServer {
+	return &liveServer{srv: srv, wait: wait, restart: restart}
+}
+
+// willRenew stops the server ahead of a renewal. The drain happens
+// outside the lock, so a stop signal meanwhile isn't held up by it.
+func (l *liveServer) willRenew() {
+	l.mu.Lock()
+	srv, shuttingDown := l.srv, l.shuttingDown
+	l.mu.Unlock()
+	if shuttingDown {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.wait)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Failed to stop server for certificate renewal:", err)
+	}
+}
+
+// didRenew starts a new server with the renewed certificate, unless
+// shutdown has begun.
+func (l *liveServer) didRenew() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// don't bring a new server up behind the shutdown's back
+	if l.shuttingDown {
+		log.Println("Certificate renewed during shutdown, not restarting server")
+		return
+	}
+	l.srv = l.restart()
+}
+
+// stop marks shutdown as begun and returns the server to drain.
+func (l *liveServer) stop() *http.Server {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shuttingDown = true
+	return l.srv
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/foomo/simplecert"
+)
+
+func TestLiveServerRenewal(t *testing.T) {
+	captureLog(t)
+	first, _, _ := blockingServer(t, nil)
+	var restarts int
+	second := &http.Server{}
+	running := newLiveServer(first, time.Second, func() *http.Server {
+		restarts++
+		return second
+	})
+
+	running.willRenew()
+	running.didRenew()
+	if restarts != 1 {
+		t.Fatalf("%d restarts after a renewal, want 1", restarts)
+	}
+	if got := running.stop(); got != second {
+		t.Error("stop did not return the server started by the renewal")
+	}
+}
+
+func TestLiveServerNoRestartAfterStop(t *testing.T) {
+	logged := captureLog(t)
+	srv, _, _ := blockingServer(t, nil)
+	var restarts int
+	running := newLiveServer(srv, time.Second, func() *http.Server {
+		restarts++
+		return &http.Server{}
+	})
+
+	// a signal arrives between simplecert stopping the server and
+	// starting the renewed one
+	running.willRenew()
+	if got := running.stop(); got != srv {
+		t.Error("stop did not return the live server")
+	}
+	running.didRenew()
+	if restarts != 0 {
+		t.Errorf("%d restarts after shutdown began, want none", restarts)
+	}
+	if !strings.Contains(logged.String(), "not restarting server") {
+		t.Errorf("log %q does not mention the skipped restart", logged.String())
+	}
+}
+
+func TestLiveServerRenewalDuringShutdown(t *testing.T) {
+	captureLog(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	var restarts int
+	running := newLiveServer(ts.Config, time.Second, func() *http.Server {
+		restarts++
+		return &http.Server{}
+	})
+
+	// a renewal that starts once shutdown has begun leaves the draining
+	// server to the shutdown
+	running.stop()
+	running.willRenew()
+	if err := <-get(ts.URL); err != nil {
+		t.Errorf("server stopped by a renewal during shutdown: %v", err)
+	}
+	running.didRenew()
+	if restarts != 0 {
+		t.Errorf("%d restarts after shutdown began, want none", restarts)
+	}
+}
+
+func TestLiveServerStopDuringRenewalDrain(t *testing.T) {
+	captureLog(t)
+	release := make(chan struct{})
+	srv, url, started := blockingServer(t, release)
+	running := newLiveServer(srv, time.Minute, func() *http.Server { return &http.Server{} })
+
+	result := get(url)
+	<-started
+	draining := make(chan struct{})
+	srv.RegisterOnShutdown(func() { close(draining) })
+	renewing := make(chan struct{})
+	go func() {
+		running.willRenew()
+		close(renewing)
+	}()
+	<-draining
+
+	stopped := make(chan *http.Server, 1)
+	go func() { stopped <- running.stop() }()
+	select {
+	case got := <-stopped:
+		if got != srv {
+			t.Error("stop did not return the draining server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop blocked behind the renewal's drain")
+	}
+	close(release)
+	<-result
+	<-renewing
+}
+
+func TestShutdownAfterRenewal(t *testing.T) {
+	captureLog(t)
+	first, _, _ := blockingServer(t, nil)
+	release := make(chan struct{})
+	second, url, started := blockingServer(t, release)
+	running := newLiveServer(first, time.Second, func() *http.Server { return second })
+	ready := &readiness{}
+	ready.set(true)
+	lc := newLifecycle(ready, running.stop, func(int) {})
+	lc.wait = 5 * time.Second
+
+	running.willRenew()
+	running.didRenew()
+
+	// the signal has to drain the server the renewal started
+	result := get(url)
+	<-started
+	sigs := make(chan os.Signal, 1)
+	sigs <- syscall.SIGTERM
+	done := make(chan error, 1)
+	go func() { done <- lc.Run(sigs) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned %v with a request in flight on the renewed server", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v", err)
+	}
+	if err := <-get(url); err == nil {
+		t.Error("renewed server still answering after shutdown")
+	}
+}
+
+func TestCertConfig(t *testing.T) {
+	args := CmdLineArgs{
+		Domain:     "example.com",
+		CertCache:  "/var/cache/certs",
+		SSLEmail:   "admin@example.com",
+		RenewCheck: 6 * time.Hour,
+	}
+	cfg, err := certConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CheckInterval != 6*time.Hour {
+		t.Errorf("CheckInterval = %v, want 6h", cfg.CheckInterval)
+	}
+	if len(cfg.Domains) != 1 || cfg.Domains[0] != "example.com" {
+		t.Errorf("Domains = %q", cfg.Domains)
+	}
+	if cfg.CacheDir != "/var/cache/certs" || cfg.SSLEmail != "admin@example.com" {
+		t.Errorf("CacheDir %q, SSLEmail %q", cfg.CacheDir, cfg.SSLEmail)
+	}
+	if cfg.HTTPAddress != "" {
+		t.Errorf("HTTPAddress = %q, want none", cfg.HTTPAddress)
+	}
+	if cfg == simplecert.Default || simplecert.Default.CheckInterval == 6*time.Hour {
+		t.Error("certConfig changed simplecert.Default")
+	}
+
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		args.RenewCheck = interval
+		if _, err := certConfig(args); err == nil {
+			t.Errorf("-renew-check-interval %v accepted", interval)
+		}
+	}
+}
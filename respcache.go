@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedResponseSize is the largest response body the response cache
+// will hold; bigger responses are passed through uncached.
+const maxCachedResponseSize = 1 << 20
+
+// cachedResponse is a stored response along with the request header
+// values it was selected by (per its Vary header).
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	vary    map[string]string
+	expires time.Time
+}
+
+// responseCache is a short-lived cache for GET responses, used to
+// deduplicate identical requests to expensive backends.
+type responseCache struct {
+	ttl time.Duration
+	// now is the clock used to expire entries, swappable for testing
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string][]*cachedResponse
+	// nextSweep is when store next drops expired entries of every key
+	nextSweep time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string][]*cachedResponse),
+	}
+}
+
+// cacheKey identifies the resource a request is for.
+func cacheKey(r *http.Request) string {
+	return r.Method + " " + r.Host + r.URL.RequestURI()
+}
+
+// isCacheableRequest reports whether a request may be answered from, or
+// stored in, the cache. Requests with credentials are personal, so they
+// are never shared.
+func isCacheableRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		r.Header.Get("Authorization") == "" &&
+		r.Header.Get("Cookie") == "" &&
+		r.Header.Get("Range") == ""
+}
+
+// responseTTL returns how long a response may be cached given its
+// headers, capped at max. Only responses that say they may be shared,
+// with public, max-age or s-maxage, are cached. Zero means it must not
+// be cached.
+func responseTTL(h http.Header, max time.Duration) time.Duration {
+	if h.Get("Set-Cookie") != "" || h.Get("Vary") == "*" {
+		return 0
+	}
+	ttl := max
+	explicit := false
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store", directive == "no-cache", directive == "private":
+			return 0
+		case directive == "public":
+			explicit = true
+		case strings.HasPrefix(directive, "max-age="), strings.HasPrefix(directive, "s-maxage="):
+			secs, err := strconv.Atoi(directive[strings.IndexByte(directive, '=')+1:])
+			if err != nil || secs <= 0 {
+				return 0
+			}
+			if d := time.Duration(secs) * time.Second; d < ttl {
+				ttl = d
+			}
+			explicit = true
+		}
+	}
+	if !explicit {
+		return 0
+	}
+	return ttl
+}
+
+// varyValues captures the request header values named by a response's
+// Vary header.
+func varyValues(r *http.Request, h http.Header) map[string]string {
+	values := make(map[string]string)
+	for _, field := range h.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" {
+				values[name] = r.Header.Get(name)
+			}
+		}
+	}
+	return values
+}
+
+// lookup returns an unexpired response stored for the request, if any.
+func (c *responseCache) lookup(r *http.Request) *cachedResponse {
+	now := c.now()
+	key := cacheKey(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, resp := range c.entries[key] {
+		if now.After(resp.expires) {
+			continue
+		}
+		matches := true
+		for name, value := range resp.vary {
+			if r.Header.Get(name) != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return resp
+		}
+	}
+	return nil
+}
+
+// store saves a response for the request, replacing any stored variant
+// with the same Vary values and dropping expired ones. Once per ttl it
+// also sweeps out the expired entries of every other key, which would
+// otherwise stay until their URL was requested again.
+func (c *responseCache) store(r *http.Request, resp *cachedResponse) {
+	now := c.now()
+	key := cacheKey(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.After(c.nextSweep) {
+		c.sweep(now)
+		c.nextSweep = now.Add(c.ttl)
+	}
+	kept := []*cachedResponse{resp}
+	for _, old := range c.entries[key] {
+		if now.After(old.expires) || sameVary(old.vary, resp.vary) {
+			continue
+		}
+		kept = append(kept, old)
+	}
+	c.entries[key] = kept
+}
+
+// sweep drops expired entries, and keys left with none.
+func (c *responseCache) sweep(now time.Time) {
+	for key, resps := range c.entries {
+		var kept []*cachedResponse
+		for _, resp := range resps {
+			if !now.After(resp.expires) {
+				kept = append(kept, resp)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.entries, key)
+		} else {
+			c.entries[key] = kept
+		}
+	}
+}
+
+func sameVary(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if v, ok := b[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheWriter passes a response through to the client while keeping a
+// copy of it for the cache, giving up on the copy if it grows too big.
+type cacheWriter struct {
+	http.ResponseWriter
+	status int
+	// header is the response's header as the handler sent it, before
+	// outer middleware, such as compression, changed it to go with a
+	// body other than the one kept here
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (cw *cacheWriter) WriteHeader(status int) {
+	if cw.status == 0 && !interimStatus(status) {
+		cw.status = status
+		cw.header = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+		cw.header = cw.Header().Clone()
+	}
+	if !cw.overflow {
+		if cw.body.Len()+len(b) > maxCachedResponseSize {
+			cw.overflow = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming responses through the writer.
+func (cw *cacheWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// wrap serves cacheable requests from the cache when possible and
+// stores cacheable 2xx responses from next.
+func (c *responseCache) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isCacheableRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if resp := c.lookup(r); resp != nil {
+			for name, values := range resp.header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+		}
+
+		cw := &cacheWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		if cw.overflow || cw.status < 200 || cw.status > 299 {
+			return
+		}
+		header := cw.header
+		ttl := responseTTL(header, c.ttl)
+		if ttl <= 0 {
+			return
+		}
+		c.store(r, &cachedResponse{
+			status:  cw.status,
+			header:  header,
+			body:    append([]byte(nil), cw.body.Bytes()...),
+			vary:    varyValues(r, header),
+			expires: c.now().Add(ttl),
+		})
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+	}{
+		{"", 0},
+		{"public", time.Minute},
+		{"max-age=10", 10 * time.Second},
+		{"public, s-maxage=3600", time.Minute},
+		{"max-age=0", 0},
+		{"no-store", 0},
+		{"public, no-cache", 0},
+		{"private, max-age=10", 0},
+		{"must-revalidate", 0},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.cacheControl != "" {
+			h.Set("Cache-Control", tt.cacheControl)
+		}
+		if got := responseTTL(h, time.Minute); got != tt.want {
+			t.Errorf("responseTTL(%q) = %v, want %v", tt.cacheControl, got, tt.want)
+		}
+	}
+}
+
+// cachedBackend counts the requests that get past the cache.
+func cachedBackend(cacheControl string) (http.Handler, *int) {
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", cacheControl)
+		fmt.Fprintf(w, "response %d", calls)
+	}), &calls
+}
+
+func TestResponseCacheDeduplicates(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	c := newResponseCache(time.Minute)
+	c.now = func() time.Time { return now }
+	backend, calls := cachedBackend("max-age=30")
+	h := c.wrap(backend)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+		if w.Body.String() != "response 1" {
+			t.Errorf("request %d got %q, want the cached response", i, w.Body.String())
+		}
+	}
+	now = now.Add(31 * time.Second)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+	if w.Body.String() != "response 2" || *calls != 2 {
+		t.Errorf("after expiry got %q with %d calls", w.Body.String(), *calls)
+	}
+}
+
+func TestResponseCacheSkipsCredentials(t *testing.T) {
+	c := newResponseCache(time.Minute)
+	backend, calls := cachedBackend("public, max-age=30")
+	h := c.wrap(backend)
+
+	for _, header := range []string{"Cookie", "Authorization"} {
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest("GET", "/api/me", nil)
+			r.Header.Set(header, "secret")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}
+	if *calls != 4 {
+		t.Errorf("backend saw %d requests, want all 4", *calls)
+	}
+}
+
+func TestResponseCacheNeedsExplicitCaching(t *testing.T) {
+	c := newResponseCache(time.Minute)
+	backend, calls := cachedBackend("")
+	h := c.wrap(backend)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items", nil))
+	if *calls != 2 {
+		t.Errorf("backend saw %d requests, want 2", *calls)
+	}
+}
+
+func TestResponseCacheSweepsExpiredKeys(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	c := newResponseCache(time.Minute)
+	c.now = func() time.Time { return now }
+	backend, _ := cachedBackend("max-age=10")
+	h := c.wrap(backend)
+
+	for i := 0; i < 10; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", fmt.Sprintf("/api/items/%d", i), nil))
+	}
+	now = now.Add(2 * time.Minute)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/other", nil))
+	if len(c.entries) != 1 {
+		t.Errorf("cache holds %d keys, want only the fresh one", len(c.entries))
+	}
+}
+
+func TestCacheWriterFlushAndUnwrap(t *testing.T) {
+	w := httptest.NewRecorder()
+	cw := &cacheWriter{ResponseWriter: w}
+	cw.Write([]byte("partial"))
+	cw.Flush()
+	if !w.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if cw.Unwrap() != w {
+		t.Error("Unwrap did not return the underlying writer")
+	}
+}
+
+func TestResponseCacheUnderGzip(t *testing.T) {
+	payload := strings.Repeat(`{"id": 1, "name": "item"},`, 200)
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.Write([]byte(payload))
+	}))
+	defer upstream.Close()
+	srv := httptest.NewServer(newTestServer(t,
+		"-rootdir", writeTree(t, "index.html"),
+		"-proxy", "/api="+upstream.URL,
+		"-cache-responses-ttl", "1m",
+	).Handler)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/items", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("request %d: Content-Encoding %q, want gzip", i+1, resp.Header.Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		body, err := ioutil.ReadAll(zr)
+		resp.Body.Close()
+		if err != nil || string(body) != payload {
+			t.Errorf("request %d: body does not decode to the upstream's: %v", i+1, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("upstream saw %d requests, want the second served from the cache", calls)
+	}
+}
+
+func TestResponseCacheSkipsInterimResponses(t *testing.T) {
+	calls := 0
+	h := newResponseCache(time.Minute).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusContinue)
+		w.Header().Set("Cache-Control", "max-age=30")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	for i := 0; i < 2; i++ {
+		w := &interimRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "ok" {
+			t.Errorf("request %d: got %d %q", i+1, w.Code, w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("backend saw %d requests, want the 200 after the 100 cached", calls)
+	}
+}
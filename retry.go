@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// isIdempotent reports whether a request with this method may safely
+// be sent more than once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryTransport retries idempotent, bodiless proxy requests that fail
+// to get a response, waiting backoff between attempts and moving on to
+// the next upstream the balancer picks.
+type retryTransport struct {
+	base    http.RoundTripper
+	b       *balancer
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if !isIdempotent(req.Method) || (req.Body != nil && req.Body != http.NoBody) {
+		return resp, err
+	}
+	for i := 0; err != nil && i < t.retries; i++ {
+		t.b.markDown(req.URL.Host)
+
+		timer := time.NewTimer(t.backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		// upstreams are assumed to serve the same paths, so only the
+		// scheme and host change between attempts
+		target := t.b.pick().target
+		req = req.Clone(req.Context())
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		resp, err = t.base.RoundTrip(req)
+	}
+	return resp, err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// deadUpstream returns the URL of a server that is no longer listening.
+func deadUpstream(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+func TestProxyRetries(t *testing.T) {
+	live := backend(t, "ok")
+	targets, err := parseUpstreams(deadUpstream(t) + "," + live.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	h := newProxy(targets, proxyOptions{retries: 1})
+
+	// the first request goes to the dead upstream and is retried
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("GET: got %d %q, want it retried on the live upstream", w.Code, w.Body.String())
+	}
+
+	h = newProxy(targets, proxyOptions{retries: 1})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api", strings.NewReader("{}")))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("POST: status = %d, want 502 without a retry", w.Code)
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	for method, want := range map[string]bool{
+		"GET": true, "HEAD": true, "OPTIONS": true,
+		"POST": false, "PUT": false, "PATCH": false, "DELETE": false,
+	} {
+		if got := isIdempotent(method); got != want {
+			t.Errorf("isIdempotent(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// pathRewriteFlag collects repeated -proxy-rewrite flags of the form
+// /public=/backend, mapping a public path prefix to the one the backend
+// expects.
+type pathRewriteFlag map[string]string
+
+func (f pathRewriteFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for from, to := range f {
+		pairs = append(pairs, from+"="+to)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (f pathRewriteFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") || !strings.HasPrefix(parts[1], "/") {
+		return fmt.Errorf("expected /prefix=/replacement, got %q", value)
+	}
+	f[strings.TrimSuffix(parts[0], "/")] = strings.TrimSuffix(parts[1], "/")
+	return nil
+}
+
+// rewrite replaces the longest matching prefix of the request's path.
+func (f pathRewriteFlag) rewrite(req *http.Request) {
+	from := ""
+	for prefix := range f {
+		if len(prefix) > len(from) && hasPathPrefix(req.URL.Path, prefix) {
+			from = prefix
+		}
+	}
+	if from == "" {
+		return
+	}
+	to := f[from]
+	req.URL.Path = to + strings.TrimPrefix(req.URL.Path, from)
+	if req.URL.RawPath != "" {
+		if strings.HasPrefix(req.URL.RawPath, from) {
+			req.URL.RawPath = to + strings.TrimPrefix(req.URL.RawPath, from)
+		} else {
+			req.URL.RawPath = ""
+		}
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+}
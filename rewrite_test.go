@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathRewrite(t *testing.T) {
+	f := pathRewriteFlag{}
+	for _, value := range []string{"/api=/v2", "/api/legacy/=/", "/files=/storage/files"} {
+		if err := f.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"/api/users", "/v2/users"},
+		{"/api", "/v2"},
+		{"/api/legacy/thing", "/thing"},
+		{"/api/legacy", "/"},
+		{"/apis", "/apis"},
+		{"/files/a%2Fb.txt", "/storage/files/a%2Fb.txt"},
+		{"/other", "/other"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		f.rewrite(req)
+		if got := req.URL.EscapedPath(); got != tt.want {
+			t.Errorf("rewrite(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"/api", "api=/v2", "/api=v2"} {
+		if err := (pathRewriteFlag{}).Set(bad); err == nil {
+			t.Errorf("Set(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	root := writeTree(t, "index.html", "app.js")
+	spa := spaHandler{staticPath: root, indexPath: "index.html"}
+	h := securityHeaders("default-src 'self'", hstsValue, spa)
+	want := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Content-Security-Policy":   "default-src 'self'",
+		"Strict-Transport-Security": "max-age=31536000",
+	}
+	for _, path := range []string{"/app.js", "/some/route", "/missing.js"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		for name, value := range want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("%s: %s = %q, want %q", path, name, got, value)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	securityHeaders("", "", http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	for _, name := range []string{"Content-Security-Policy", "Strict-Transport-Security"} {
+		if _, ok := w.Header()[name]; ok {
+			t.Errorf("%s set without its flag", name)
+		}
+	}
+}
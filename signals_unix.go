@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// promoteSignals trigger promotion of the staging directory.
+var promoteSignals = []os.Signal{syscall.SIGUSR1}
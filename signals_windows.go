@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// promoteSignals trigger promotion of the staging directory. Windows has
+// no user signals, so promotion is not available there.
+var promoteSignals []os.Signal
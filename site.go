@@ -0,0 +1,499 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+)
+
+// web server timeouts, in seconds
+const (
+	writeTimeout = 1 * 60
+	readTimeout  = 1 * 60
+	idleTimeout  = 2 * 60
+)
+
+// site is what every server main builds shares: the settings parsed
+// from the arguments and the state that outlives a server, such as the
+// preloaded index, limits and counters, which are kept across
+// certificate renewals and config reloads.
+type site struct {
+	basePath     string
+	indexPath    string
+	altIndexes   []string
+	buildTime    time.Time
+	locales      map[string]string
+	sourcemaps   ipAllowlist
+	headerNames  map[string]string
+	assetPattern *regexp.Regexp
+	cors         *cors.Cors
+
+	index     *indexCache
+	assets    http.FileSystem
+	render    *indexRenderer
+	generated *generatedIndex
+	staged    *stagedRoot
+	gzipped   gzipStore
+	files     *fileCache
+
+	queue      *fairQueue
+	stats      *serverStats
+	totals     *trafficTotals
+	ready      *readiness
+	openFiles  chan struct{}
+	overloaded func() bool
+	limiter    *rateLimiter
+	proxyOpts  proxyOptions
+}
+
+// newSite parses and loads what the servers for args share.
+func newSite(args CmdLineArgs) (*site, error) {
+	s := &site{basePath: strings.TrimSuffix(args.BasePath, "/")}
+	var err error
+	if args.BuildTime != "" {
+		s.buildTime, err = time.Parse(time.RFC3339, args.BuildTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build time: %v", err)
+		}
+	}
+	s.locales, err = parseLocaleMap(args.GeoLocales)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geo locale map: %v", err)
+	}
+	s.sourcemaps, err = parseIPAllowlist(args.SourceMapIPs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source map allowlist: %v", err)
+	}
+	trustedProxies, err := parseIPAllowlist(args.TrustedProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+	s.headerNames, err = parseHeaderCase(args.HeaderCase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header casing: %v", err)
+	}
+	if args.AssetPattern != "" {
+		s.assetPattern, err = regexp.Compile(args.AssetPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset pattern: %v", err)
+		}
+	}
+	indexes := splitList(args.IndexChain)
+	if len(indexes) == 0 {
+		return nil, errors.New("at least one index file is required")
+	}
+	s.indexPath, s.altIndexes = indexes[0], indexes[1:]
+	// a binary built with -tags embed serves its own copy of the app
+	// unless told to serve a directory
+	if embedded := embeddedAssets(); embedded != nil && !flagPassed("rootdir") {
+		if args.PreloadIndex || args.PreGzip || args.StagingDir != "" || args.ZipDownloads || args.EnvInject || args.BustAssets != "" || args.InlineCSS != "" {
+			return nil, errors.New("-preload-index, -pregzip, -staging-dir, -zip-downloads, -env-inject, -bust-assets and -inline-css need -rootdir")
+		}
+		s.assets = http.FS(embedded)
+		log.Println("Serving embedded assets")
+	}
+	corsOpts, err := corsOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	s.cors = cors.New(corsOpts)
+	var transforms []indexTransform
+	if args.EnvInject {
+		transforms = append(transforms, newEnvInjector(args.EnvPrefix, configEnvVars()).inject)
+	}
+	if args.InlineCSS != "" {
+		transform, err := inlineCSS(args.InlineCSS, args.InlineCSSHref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inline CSS: %v", err)
+		}
+		transforms = append(transforms, transform)
+	}
+	if args.BustAssets != "" {
+		transforms = append(transforms, bustAssets(args.BustAssets))
+	}
+	// the index is served from memory unless told otherwise; without
+	// anything to rewrite, -no-cache-index serves it straight from disk
+	if !args.NoCacheIndex || len(transforms) > 0 {
+		s.render = newIndexRenderer(args.NoCacheIndex, transforms...)
+		if s.assets == nil {
+			s.render.render(findIndex(args.RootDir, s.indexPath, s.altIndexes))
+		}
+	}
+	if args.GenIndex {
+		s.generated, err = newGeneratedIndex(args.AppTitle, args.AppRootID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate index: %v", err)
+		}
+	}
+	if args.PreloadIndex {
+		path := findIndex(args.RootDir, s.indexPath, s.altIndexes)
+		if _, err := os.Stat(path); os.IsNotExist(err) && s.generated != nil {
+			log.Println("No index to preload, serving a generated one")
+		} else {
+			s.index, err = newIndexCache(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to preload index: %v", err)
+			}
+		}
+	}
+	if args.DebugServed && (args.SSL || args.TLSCert != "") {
+		log.Println("Warning: -debug-served-file exposes file paths and is meant for development, not production")
+	}
+	if s.basePath != "" && !strings.HasPrefix(s.basePath, "/") {
+		return nil, fmt.Errorf("base path must start with /: %s", args.BasePath)
+	}
+	if args.StagingDir != "" {
+		if len(promoteSignals) == 0 {
+			return nil, errors.New("staging directories are not supported on this platform")
+		}
+		s.staged = newStagedRoot(args.RootDir, args.StagingDir)
+	}
+	if args.PreGzip {
+		s.gzipped, err = newGzipStore(args.RootDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to precompress assets: %v", err)
+		}
+		log.Printf("Precompressed %d assets\n", len(s.gzipped))
+	}
+	if args.CacheFiles {
+		s.files = newFileCache(args.CacheTTL)
+	}
+
+	// shared by every server so the limits hold across cert renewals
+	s.queue = newFairQueue(args.MaxActive, args.QueueSize)
+	s.stats = newServerStats()
+	if args.Stats && args.AdminToken == "" {
+		log.Println("Warning: /stats is enabled without -admin-token, anyone can read it")
+	}
+	if args.MaxOpenFiles > 0 {
+		s.openFiles = make(chan struct{}, args.MaxOpenFiles)
+	}
+
+	if args.Gzip && args.CompressCPU > 0 {
+		monitor, err := newLoadMonitor(args.CompressCPU, readLoadAvg, loadSampleInterval)
+		if err != nil {
+			log.Println("Warning: cannot read the system load, -compress-cpu-threshold is ignored:", err)
+		} else {
+			s.overloaded = monitor.overloaded
+		}
+	}
+
+	if args.RateLimit > 0 {
+		s.limiter = newRateLimiter(args.RateLimit, args.RateBurst, trustedProxies)
+	}
+
+	if len(args.ProxyHosts) > 0 || len(args.ProxyPaths) > 0 {
+		s.proxyOpts = proxyOptions{
+			cacheTTL:         args.ProxyCache,
+			random:           args.ProxyRandom,
+			cooldown:         args.ProxyCool,
+			forwardHeaders:   splitList(args.ProxyForward),
+			gzipJSON:         args.ProxyGzip,
+			retries:          args.ProxyRetries,
+			retryBackoff:     args.ProxyBackoff,
+			breakerThreshold: args.BreakerLimit,
+			breakerWindow:    args.BreakerSpan,
+			breakerCooldown:  args.BreakerCool,
+			retryAfter:       args.RetryAfter,
+			expectContinue:   args.ProxyExpect,
+			rewrites:         args.ProxyRewrite,
+			onUnreachable:    s.stats.proxyError,
+		}
+		if args.ProxyErrPage != "" {
+			page, err := newProxyErrorPage(args.ProxyErrPage)
+			if err != nil {
+				return nil, fmt.Errorf("could not read proxy error page: %v", err)
+			}
+			s.proxyOpts.errorPage = page
+		}
+		if args.DebugBodies {
+			log.Println("Warning: logging proxied request and response bodies")
+			s.proxyOpts.debugBodies = newBodyLogger(args.DebugSample, args.DebugLimit, splitList(args.DebugRedact))
+		}
+	}
+
+	s.totals = newTrafficTotals()
+	s.ready = &readiness{retryAfter: args.RetryAfter}
+	s.ready.set(true)
+	return s, nil
+}
+
+// corsOptions returns the CORS settings for args. Preflights pass
+// through to answerOptions, which gives them a 204.
+func corsOptions(args CmdLineArgs) (cors.Options, error) {
+	opts := cors.Options{OptionsPassthrough: true}
+	if args.CORSOrigins == "" && args.CORSMethods == "" && args.CORSHeaders == "" && !args.CORSCreds {
+		log.Println("Warning: allowing cross-origin requests from any origin; set -cors-origins to restrict them")
+		return opts, nil
+	}
+	origins := splitList(args.CORSOrigins)
+	if args.CORSCreds {
+		// browsers refuse credentialed responses allowing any origin
+		if len(origins) == 0 {
+			return opts, errors.New("-cors-credentials requires -cors-origins")
+		}
+		for _, origin := range origins {
+			if origin == "*" {
+				return opts, errors.New("-cors-credentials cannot be combined with the * origin")
+			}
+		}
+	}
+	opts.AllowedOrigins = origins
+	opts.AllowedMethods = splitList(args.CORSMethods)
+	opts.AllowedHeaders = splitList(args.CORSHeaders)
+	opts.AllowCredentials = args.CORSCreds
+	return opts, nil
+}
+
+// makeServer builds a server for addr that serves the site with args,
+// which may differ from the ones the site was made with after a config
+// reload.
+func (s *site) makeServer(args CmdLineArgs, addr string) *http.Server {
+	basePath := s.basePath
+	r := mux.NewRouter()
+
+	// app holds the routes that live under the base path, if any
+	app := r
+	if basePath != "" {
+		r.Path(basePath).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		})
+		app = r.PathPrefix(basePath).MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+			// PathPrefix alone would also match /admins for /admin
+			return hasPathPrefix(r.URL.Path, basePath)
+		}).Subrouter()
+	}
+
+	// ping for convenience
+	app.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		// for HEAD, net/http sends the same headers and drops the body
+		w.Write([]byte("{\"response\": \"pong\"}"))
+	}).Methods("GET", "HEAD")
+
+	// liveness and readiness for orchestrators and load balancers
+	app.HandleFunc("/healthz", healthz).Methods("GET", "HEAD")
+	app.Handle("/readyz", s.ready).Methods("GET", "HEAD")
+
+	if args.Stats {
+		r.Handle("/stats", requireToken(args.AdminToken, s.stats)).Methods("GET")
+	}
+
+	if args.LBCheckPath != "" {
+		r.HandleFunc(args.LBCheckPath, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}).Methods("GET", "HEAD")
+	}
+
+	if args.CSPReportURI != "" {
+		r.HandleFunc(args.CSPReportURI, cspReportHandler).Methods("POST")
+	}
+
+	spa := spaHandler{
+		staticPath:        args.RootDir,
+		indexPath:         s.indexPath,
+		altIndexes:        s.altIndexes,
+		index:             s.index,
+		files:             s.files,
+		hideIndex:         args.HideIndex,
+		markdownPrefix:    args.MarkdownDir,
+		timingAllowOrigin: args.TimingOrigin,
+		nosniff:           args.NoSniff,
+		staged:            s.staged,
+		dev:               args.Dev,
+		isolate:           args.Isolate,
+		noFollowSymlinks:  args.NoSymlinks,
+		openFiles:         s.openFiles,
+		openWait:          args.OpenWait,
+		retryAfter:        args.RetryAfter,
+		gzipped:           s.gzipped,
+		apiPrefix:         args.APIPrefix,
+		precompressed:     args.Precompressed,
+		sourcemaps:        s.sourcemaps,
+		assetPattern:      s.assetPattern,
+		staticMaxAge:      args.StaticMaxAge,
+		fallbackExclude:   splitList(args.NoFallback),
+		debugServedFile:   args.DebugServed,
+		generated:         s.generated,
+		render:            s.render,
+		fsys:              s.assets,
+		allowExt:          parseExtList(args.AllowExt),
+		notFoundFile:      args.NotFoundFile,
+		etags:             newETagCache(),
+	}
+
+	if args.ZipDownloads {
+		zip := zipHandler{
+			spa:     spa,
+			bufSize: args.CopyBuffer,
+		}
+		app.Handle("/download.zip", zip).Methods("GET")
+	}
+
+	var spaRoute http.Handler = spa
+	if args.HeadAsGet {
+		spaRoute = foldHead(spaRoute)
+	}
+	if prefixes := splitList(args.NoRanges); len(prefixes) > 0 {
+		spaRoute = disableRanges(prefixes, spaRoute)
+	}
+	if !s.buildTime.IsZero() {
+		spaRoute = fixedLastModified(s.buildTime, spaRoute)
+	}
+
+	// handlers that look files up do so relative to the root, not the
+	// base path
+	strip := func(h http.Handler) http.Handler {
+		if basePath == "" {
+			return h
+		}
+		return http.StripPrefix(basePath, h)
+	}
+
+	if len(args.AppConfig) > 0 {
+		appConfig, err := newAppConfigHandler(args.AppConfig, spa.root, spaRoute)
+		if err != nil {
+			log.Fatal("Invalid app config: ", err)
+		}
+		app.Handle(args.AppConfigURL, strip(appConfig)).Methods("GET", "HEAD")
+	}
+
+	if len(s.locales) > 0 {
+		app.Path("/").Handler(strip(localeRedirect{
+			header:   args.GeoHeader,
+			locales:  s.locales,
+			fallback: args.RootRedirect,
+			next:     spaRoute,
+		}))
+	} else if args.RootRedirect != "" {
+		app.Path("/").Handler(http.RedirectHandler(args.RootRedirect, http.StatusFound))
+	}
+
+	// proxied prefixes never fall back to the index; longest first, as
+	// routes match in the order they are added
+	for _, prefix := range args.ProxyPaths.prefixes() {
+		prefix := prefix
+		app.PathPrefix(prefix).MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+			return hasPathPrefix(strings.TrimPrefix(r.URL.Path, basePath), prefix)
+		}).Handler(strip(newProxy(args.ProxyPaths[prefix], s.proxyOpts)))
+	}
+
+	app.PathPrefix("/").Handler(strip(spaRoute))
+
+	manualTLS := args.TLSCert != "" || args.TLSKey != ""
+	var handler http.Handler = r
+	if args.MaxActive > 0 {
+		handler = limitConcurrency(s.queue, args.RetryAfter, handler)
+	}
+	if args.StrictPaths {
+		handler = rejectControlChars(handler)
+	}
+	if args.CSPReport != "" {
+		handler = cspReportOnly(args.CSPReport, args.CSPReportURI, handler)
+	}
+	if args.SecHeaders {
+		hsts := ""
+		if args.HSTS && (args.SSL || manualTLS) {
+			hsts = hstsValue
+		}
+		handler = securityHeaders(args.CSP, hsts, handler)
+	}
+	if len(args.HeaderRules) > 0 {
+		handler = headerRules(args.HeaderRules, handler)
+	}
+	if args.HTTP3 {
+		handler = advertiseHTTP3(args.Port, handler)
+	}
+	if args.Gzip {
+		handler = gzipHandler(args.GzipMinBytes, parseExtList(args.CompressExt), s.overloaded, args.GzipLength, handler)
+	}
+	if args.Bandwidth > 0 {
+		handler = throttle(args.Bandwidth, handler)
+	}
+	routes := handler
+	handler = s.cors.Handler(answerOptions(handler))
+	if len(args.ProxyPaths) > 0 {
+		proxied := func(r *http.Request) bool {
+			if basePath != "" && !hasPathPrefix(r.URL.Path, basePath) {
+				return false
+			}
+			for prefix := range args.ProxyPaths {
+				if hasPathPrefix(strings.TrimPrefix(r.URL.Path, basePath), prefix) {
+					return true
+				}
+			}
+			return false
+		}
+		handler = forwardOptions(proxied, routes, handler)
+	}
+	if len(args.ProxyHosts) > 0 {
+		handler = hostProxy(args.ProxyHosts, s.proxyOpts, handler)
+	}
+	if args.UnknownHost != "" {
+		known := map[string]bool{}
+		if args.Domain != "" {
+			known[strings.ToLower(args.Domain)] = true
+		}
+		for host := range args.ProxyHosts {
+			known[host] = true
+		}
+		exempt := map[string]bool{}
+		for _, path := range []string{"/ping", "/healthz", "/readyz"} {
+			exempt[basePath+path] = true
+		}
+		if args.LBCheckPath != "" {
+			exempt[args.LBCheckPath] = true
+		}
+		handler = checkHost(known, exempt, args.UnknownHost, args.Domain, handler)
+	}
+	if host := args.DefaultHost; host != "" || args.Domain != "" {
+		if host == "" {
+			host = args.Domain
+		}
+		handler = defaultHost(host, handler)
+	}
+	if s.limiter != nil {
+		handler = s.limiter.limit(handler)
+	}
+	if args.LogFormat != "" || args.LogErrors {
+		format := args.LogFormat
+		if format == "" {
+			format = "text"
+		}
+		handler = accessLog(format, args.LogErrors, handler)
+	}
+	if args.LogTotals {
+		handler = s.totals.count(handler)
+	}
+	if args.Stats {
+		handler = s.stats.record(handler)
+	}
+	if len(s.headerNames) > 0 {
+		// last, so no other middleware sets headers after it
+		handler = headerCase(s.headerNames, handler)
+	}
+	server := &http.Server{
+		Handler:      handler,
+		Addr:         addr,
+		WriteTimeout: writeTimeout * time.Second,
+		ReadTimeout:  readTimeout * time.Second,
+		IdleTimeout:  idleTimeout * time.Second,
+	}
+	if !args.HTTP2 {
+		// a non-nil, empty map keeps net/http from enabling HTTP/2
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// stagedRoot is the directory being served together with a staging
+// directory that new content is deployed into. Promoting swaps the two
+// atomically, so requests never see a half-written directory.
+type stagedRoot struct {
+	live atomic.Value // string
+
+	mu      sync.Mutex
+	staging string
+}
+
+func newStagedRoot(live, staging string) *stagedRoot {
+	s := &stagedRoot{staging: staging}
+	s.live.Store(live)
+	return s
+}
+
+// dir returns the directory currently being served.
+func (s *stagedRoot) dir() string {
+	return s.live.Load().(string)
+}
+
+// promote makes the staging directory live. The previously live
+// directory becomes the staging directory for the next deploy. It
+// returns the newly live directory.
+func (s *stagedRoot) promote() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.staging)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("staging path %s is not a directory", s.staging)
+	}
+	live := s.dir()
+	s.live.Store(s.staging)
+	s.staging = live
+	return s.dir(), nil
+}
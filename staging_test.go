@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStagedRootPromote(t *testing.T) {
+	live := writeTree(t, "index.html", "old.js")
+	staging := writeTree(t, "index.html", "new.js")
+	s := newStagedRoot(live, staging)
+	h := spaHandler{staticPath: live, indexPath: "index.html", staged: s}
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+	if got := get("/old.js"); got != "old.js" {
+		t.Fatalf("before promoting got %q", got)
+	}
+
+	dir, err := s.promote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != staging || s.dir() != staging {
+		t.Errorf("promote() = %q, dir() = %q, want %q", dir, s.dir(), staging)
+	}
+	if got := get("/new.js"); got != "new.js" {
+		t.Errorf("after promoting got %q", got)
+	}
+
+	// the old root is staged for the next deploy
+	if dir, _ := s.promote(); dir != live {
+		t.Errorf("second promote() = %q, want %q", dir, live)
+	}
+}
+
+func TestStagedRootPromoteMissing(t *testing.T) {
+	live := writeTree(t, "index.html")
+	s := newStagedRoot(live, filepath.Join(live, "missing"))
+	if _, err := s.promote(); err == nil {
+		t.Error("promoted a missing directory")
+	}
+	if s.dir() != live {
+		t.Errorf("dir() = %q after a failed promote, want %q", s.dir(), live)
+	}
+
+	s = newStagedRoot(live, filepath.Join(live, "index.html"))
+	if _, err := s.promote(); err == nil {
+		t.Error("promoted a file")
+	}
+}
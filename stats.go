@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// serverStats counts requests as they complete, for the /stats summary.
+type serverStats struct {
+	start time.Time
+	// byClass counts responses by status class; index 1 is 1xx, etc.
+	byClass [6]*shardedCounter
+	total   *shardedCounter
+	nanos   *shardedCounter
+	// proxyErrors counts requests no proxy backend could answer
+	proxyErrors uint64
+}
+
+func newServerStats() *serverStats {
+	s := &serverStats{
+		start: time.Now(),
+		total: newShardedCounter(),
+		nanos: newShardedCounter(),
+	}
+	for class := 1; class <= 5; class++ {
+		s.byClass[class] = newShardedCounter()
+	}
+	return s
+}
+
+// record wraps a handler to count its responses and their latency.
+func (s *serverStats) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+		status := sr.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		key := shardKey()
+		if class := status / 100; class >= 1 && class <= 5 {
+			s.byClass[class].add(key, 1)
+		}
+		s.total.add(key, 1)
+		s.nanos.add(key, int64(time.Since(start)))
+	})
+}
+
+// proxyError counts a request no proxy backend could answer.
+func (s *serverStats) proxyError() {
+	atomic.AddUint64(&s.proxyErrors, 1)
+}
+
+// ServeHTTP reports the counts so far as JSON.
+func (s *serverStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	classes := make(map[string]uint64, 5)
+	for class := 1; class <= 5; class++ {
+		classes[string(rune('0'+class))+"xx"] = uint64(s.byClass[class].load())
+	}
+	total := uint64(s.total.load())
+	var avg float64
+	if total > 0 {
+		avg = float64(s.nanos.load()) / float64(total) / float64(time.Millisecond)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(struct {
+		UptimeSeconds float64           `json:"uptime_seconds"`
+		Requests      uint64            `json:"requests"`
+		ByStatus      map[string]uint64 `json:"by_status"`
+		AvgLatencyMS  float64           `json:"avg_latency_ms"`
+		ProxyErrors   uint64            `json:"proxy_errors"`
+	}{
+		UptimeSeconds: time.Since(s.start).Seconds(),
+		Requests:      total,
+		ByStatus:      classes,
+		AvgLatencyMS:  avg,
+		ProxyErrors:   atomic.LoadUint64(&s.proxyErrors),
+	})
+}
+
+// requireToken only lets requests through that carry the admin token as
+// a bearer token. An empty token lets everything through.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
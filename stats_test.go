@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerStats(t *testing.T) {
+	s := newServerStats()
+	h := s.record(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	for _, path := range []string{"/", "/", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	s.proxyError()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var got struct {
+		Requests    uint64            `json:"requests"`
+		ByStatus    map[string]uint64 `json:"by_status"`
+		ProxyErrors uint64            `json:"proxy_errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Requests != 3 || got.ByStatus["2xx"] != 2 || got.ByStatus["4xx"] != 1 || got.ProxyErrors != 1 {
+		t.Errorf("stats = %+v", got)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := requireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		auth   string
+		status int
+	}{
+		{"Bearer secret", http.StatusOK},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/stats", nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("Authorization %q: status = %d, want %d", tt.auth, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// throttledWriter paces writes so the response body is sent at no more
+// than rate bytes per second.
+type throttledWriter struct {
+	http.ResponseWriter
+	rate    int
+	start   time.Time
+	written int64
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	// write in slices of a tenth of a second's worth so pacing is smooth
+	chunk := w.rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	total := 0
+	for len(b) > 0 {
+		n := chunk
+		if n > len(b) {
+			n = len(b)
+		}
+		// wait until sending this slice keeps us under the rate
+		due := w.start.Add(time.Duration(float64(w.written+int64(n)) / float64(w.rate) * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			time.Sleep(wait)
+		}
+		written, err := w.ResponseWriter.Write(b[:n])
+		total += written
+		w.written += int64(written)
+		if err != nil {
+			return total, err
+		}
+		b = b[n:]
+	}
+	return total, nil
+}
+
+// Flush lets streaming responses through the throttle.
+func (w *throttledWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// throttle limits each response to rate bytes per second. Protocol
+// upgrades pass straight through: once the connection is handed over
+// there are no writes left to pace.
+func throttle(rate int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&throttledWriter{ResponseWriter: w, rate: rate, start: time.Now()}, r)
+	})
+}
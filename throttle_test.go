@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	body := make([]byte, 3000)
+	h := throttle(10000, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	w := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/big.bin", nil))
+	elapsed := time.Since(start)
+
+	if w.Body.Len() != len(body) {
+		t.Errorf("sent %d bytes, want %d", w.Body.Len(), len(body))
+	}
+	// 3000 bytes at 10000 bytes a second
+	if elapsed < 250*time.Millisecond {
+		t.Errorf("took %v, want about 300ms", elapsed)
+	}
+}
+
+func TestThrottlePassesUpgrades(t *testing.T) {
+	var got http.ResponseWriter
+	h := throttle(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = w
+	}))
+	r := httptest.NewRequest("GET", "/socket", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got != w {
+		t.Errorf("upgrade request was served through %T", got)
+	}
+
+	tw := &throttledWriter{ResponseWriter: w}
+	if tw.Unwrap() != w {
+		t.Error("Unwrap did not return the underlying writer")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxTicketKeys is how many generated keys are kept: the newest issues
+// tickets and the older ones still resume sessions issued before the
+// last rotations.
+const maxTicketKeys = 3
+
+// ticketKeyRotator installs TLS session ticket keys on a config and
+// replaces them on rotate. Keys come from file, one hex-encoded 32 byte
+// key per line with the first used for new tickets, so instances sharing
+// the file resume each other's sessions; without a file, random keys
+// are generated.
+type ticketKeyRotator struct {
+	file   string
+	config *tls.Config
+
+	mu   sync.Mutex
+	keys [][32]byte
+}
+
+// newTicketKeyRotator installs the first keys on config, which from then
+// on is used for every handshake so later rotations reach servers that
+// have already cloned it.
+func newTicketKeyRotator(file string, config *tls.Config) (*ticketKeyRotator, error) {
+	t := &ticketKeyRotator{file: file, config: config}
+	if err := t.rotate(); err != nil {
+		return nil, err
+	}
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return config, nil
+	}
+	return t, nil
+}
+
+// rotate re-reads the key file, or without one generates a new key and
+// retires the oldest, and installs the result.
+func (t *ticketKeyRotator) rotate() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var keys [][32]byte
+	if t.file != "" {
+		var err error
+		keys, err = readTicketKeys(t.file)
+		if err != nil {
+			return err
+		}
+	} else {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		keys = append([][32]byte{key}, t.keys...)
+		if len(keys) > maxTicketKeys {
+			keys = keys[:maxTicketKeys]
+		}
+	}
+	t.keys = keys
+	t.config.SetSessionTicketKeys(keys)
+	return nil
+}
+
+// readTicketKeys reads hex-encoded 32 byte keys, one per line, skipping
+// blank lines and # comments.
+func readTicketKeys(file string) ([][32]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys [][32]byte
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		raw, err := hex.DecodeString(text)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("%s:%d: expected a hex-encoded 32 byte key", file, line)
+		}
+		var key [32]byte
+		copy(key[:], raw)
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no session ticket keys", file)
+	}
+	return keys, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTicketKeyRotatorGenerated(t *testing.T) {
+	r, err := newTicketKeyRotator("", &tls.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := r.keys[0]
+	for i := 0; i < maxTicketKeys+1; i++ {
+		if err := r.rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.keys) != maxTicketKeys {
+		t.Errorf("kept %d keys, want %d", len(r.keys), maxTicketKeys)
+	}
+	for _, key := range r.keys {
+		if key == first {
+			t.Error("the oldest key was not retired")
+		}
+	}
+}
+
+func TestReadTicketKeys(t *testing.T) {
+	dir := t.TempDir()
+	key := strings.Repeat("ab", 32)
+	good := filepath.Join(dir, "keys")
+	content := "# current key first\n" + key + "\n\n" + strings.Repeat("cd", 32) + "\n"
+	if err := ioutil.WriteFile(good, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := readTicketKeys(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0][0] != 0xab || keys[1][0] != 0xcd {
+		t.Errorf("keys = %x", keys)
+	}
+
+	for name, content := range map[string]string{
+		"short":   "abcd\n",
+		"not-hex": strings.Repeat("zz", 32) + "\n",
+		"empty":   "# nothing\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTicketKeys(path); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestTicketKeyRotatorFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := ioutil.WriteFile(path, []byte(strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{}
+	r, err := newTicketKeyRotator(path, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := config.GetConfigForClient(nil); got != config {
+		t.Error("handshakes don't use the rotated config")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(strings.Repeat("cd", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.keys) != 1 || r.keys[0][0] != 0xcd {
+		t.Errorf("after rotating keys = %x, want the file's new key", r.keys)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// handshakeTimeout bounds how long a limited TLS handshake may hold its
+// slot.
+const handshakeTimeout = 10 * time.Second
+
+// handshakeLimiter is a TLS listener that allows at most cap(sem) TLS
+// handshakes in flight; while they are all busy, no new connections are
+// accepted. This caps the CPU a flood of handshakes can consume.
+type handshakeLimiter struct {
+	net.Listener
+	config *tls.Config
+	sem    chan struct{}
+}
+
+func (l *handshakeLimiter) Accept() (net.Conn, error) {
+	l.sem <- struct{}{}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	tlsConn := tls.Server(conn, l.config)
+	go func() {
+		defer func() { <-l.sem }()
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		defer cancel()
+		// the server's own Handshake call waits for this one and
+		// reuses its result
+		tlsConn.HandshakeContext(ctx)
+	}()
+	return tlsConn, nil
+}
+
+// serveLimitedTLS is srv.ServeTLS with at most maxHandshakes concurrent
+// TLS handshakes.
+func serveLimitedTLS(srv *http.Server, ln net.Listener, certFile, keyFile string, maxHandshakes int) error {
+	config := &tls.Config{}
+	if srv.TLSConfig != nil {
+		config = srv.TLSConfig.Clone()
+	}
+	if config.GetCertificate == nil && len(config.Certificates) == 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+		if srv.TLSNextProto != nil && srv.TLSNextProto["h2"] == nil {
+			// HTTP/2 was turned off
+			config.NextProtos = []string{"http/1.1"}
+		}
+	}
+
+	return srv.Serve(&handshakeLimiter{
+		Listener: ln,
+		config:   config,
+		sem:      make(chan struct{}, maxHandshakes),
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testLimiter(t *testing.T, maxHandshakes int) *handshakeLimiter {
+	t.Helper()
+	certFile, keyFile := writeCert(t, nil, []net.IP{net.ParseIP("127.0.0.1")})
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &handshakeLimiter{
+		Listener: ln,
+		config:   &tls.Config{Certificates: []tls.Certificate{cert}},
+		sem:      make(chan struct{}, maxHandshakes),
+	}
+}
+
+func TestHandshakeLimiterBlocksAccept(t *testing.T) {
+	limiter := testLimiter(t, 1)
+	defer limiter.Close()
+	addr := limiter.Addr().String()
+
+	// a client that never completes its handshake holds the only slot
+	stalled, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.Accept(); err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := limiter.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	next, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	select {
+	case <-accepted:
+		t.Fatal("accepted a connection with every handshake slot busy")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stalled.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted once the stalled handshake failed")
+	}
+}
+
+func TestHandshakeLimiterServes(t *testing.T) {
+	limiter := testLimiter(t, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.Listener = limiter
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://" + limiter.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
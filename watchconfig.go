@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// configPollInterval is how often -watch-config looks at the config file.
+const configPollInterval = 2 * time.Second
+
+// liveSettings copy, from src to dst, the settings a config reload can
+// apply to the running server. They only shape the handler; the others,
+// such as -port and the TLS settings, are read once at startup and take
+// a restart.
+var liveSettings = map[string]func(dst, src *CmdLineArgs){
+	"allow-ext":            func(dst, src *CmdLineArgs) { dst.AllowExt = src.AllowExt },
+	"api-prefix":           func(dst, src *CmdLineArgs) { dst.APIPrefix = src.APIPrefix },
+	"app-config":           func(dst, src *CmdLineArgs) { dst.AppConfig = src.AppConfig },
+	"app-config-path":      func(dst, src *CmdLineArgs) { dst.AppConfigURL = src.AppConfigURL },
+	"bandwidth-limit":      func(dst, src *CmdLineArgs) { dst.Bandwidth = src.Bandwidth },
+	"compress-ext":         func(dst, src *CmdLineArgs) { dst.CompressExt = src.CompressExt },
+	"coop-coep":            func(dst, src *CmdLineArgs) { dst.Isolate = src.Isolate },
+	"csp":                  func(dst, src *CmdLineArgs) { dst.CSP = src.CSP },
+	"csp-report-only":      func(dst, src *CmdLineArgs) { dst.CSPReport = src.CSPReport },
+	"csp-report-uri":       func(dst, src *CmdLineArgs) { dst.CSPReportURI = src.CSPReportURI },
+	"default-host":         func(dst, src *CmdLineArgs) { dst.DefaultHost = src.DefaultHost },
+	"dev":                  func(dst, src *CmdLineArgs) { dst.Dev = src.Dev },
+	"fallback-exclude":     func(dst, src *CmdLineArgs) { dst.NoFallback = src.NoFallback },
+	"geo-header":           func(dst, src *CmdLineArgs) { dst.GeoHeader = src.GeoHeader },
+	"gzip-index-length":    func(dst, src *CmdLineArgs) { dst.GzipLength = src.GzipLength },
+	"gzip-min-bytes":       func(dst, src *CmdLineArgs) { dst.GzipMinBytes = src.GzipMinBytes },
+	"head-as-get":          func(dst, src *CmdLineArgs) { dst.HeadAsGet = src.HeadAsGet },
+	"header":               func(dst, src *CmdLineArgs) { dst.HeaderRules = src.HeaderRules },
+	"hide-index":           func(dst, src *CmdLineArgs) { dst.HideIndex = src.HideIndex },
+	"lb-check-path":        func(dst, src *CmdLineArgs) { dst.LBCheckPath = src.LBCheckPath },
+	"log-errors-only":      func(dst, src *CmdLineArgs) { dst.LogErrors = src.LogErrors },
+	"markdown-dir":         func(dst, src *CmdLineArgs) { dst.MarkdownDir = src.MarkdownDir },
+	"max-open-files-wait":  func(dst, src *CmdLineArgs) { dst.OpenWait = src.OpenWait },
+	"no-follow-symlinks":   func(dst, src *CmdLineArgs) { dst.NoSymlinks = src.NoSymlinks },
+	"no-ranges-prefix":     func(dst, src *CmdLineArgs) { dst.NoRanges = src.NoRanges },
+	"nosniff":              func(dst, src *CmdLineArgs) { dst.NoSniff = src.NoSniff },
+	"notfound-file":        func(dst, src *CmdLineArgs) { dst.NotFoundFile = src.NotFoundFile },
+	"precompressed":        func(dst, src *CmdLineArgs) { dst.Precompressed = src.Precompressed },
+	"reject-control-chars": func(dst, src *CmdLineArgs) { dst.StrictPaths = src.StrictPaths },
+	"root-redirect":        func(dst, src *CmdLineArgs) { dst.RootRedirect = src.RootRedirect },
+	"rootdir":              func(dst, src *CmdLineArgs) { dst.RootDir = src.RootDir },
+	"security-headers":     func(dst, src *CmdLineArgs) { dst.SecHeaders = src.SecHeaders },
+	"static-max-age":       func(dst, src *CmdLineArgs) { dst.StaticMaxAge = src.StaticMaxAge },
+	"timing-allow-origin":  func(dst, src *CmdLineArgs) { dst.TimingOrigin = src.TimingOrigin },
+}
+
+// swapHandler passes requests to a handler that can be replaced while
+// serving.
+type swapHandler struct {
+	handler atomic.Value
+}
+
+func newSwapHandler(h http.Handler) *swapHandler {
+	s := &swapHandler{}
+	s.set(h)
+	return s
+}
+
+func (s *swapHandler) set(h http.Handler) {
+	s.handler.Store(&h)
+}
+
+func (s *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load().(*http.Handler)).ServeHTTP(w, r)
+}
+
+// changedSettings returns the names of the flags whose values differ
+// between two flag sets defined by parseArgsFrom.
+func changedSettings(old, current *flag.FlagSet) []string {
+	var names []string
+	old.VisitAll(func(f *flag.Flag) {
+		if g := current.Lookup(f.Name); g != nil && g.Value.String() != f.Value.String() {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// configReloader re-reads the settings when the config file changes and
+// hands those that can be applied live to apply.
+type configReloader struct {
+	// arguments are the command line arguments, which still win over
+	// the file
+	arguments []string
+	// flags and args are the settings as last read and applied
+	flags *flag.FlagSet
+	args  CmdLineArgs
+	apply func(CmdLineArgs)
+}
+
+// reload re-reads the settings and applies the live ones that changed.
+// For any other changes it logs that a restart is needed.
+func (c *configReloader) reload() error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fresh, err := parseArgsFrom(fs, c.arguments)
+	if err != nil {
+		return err
+	}
+	applied := c.args
+	var live, restart []string
+	for _, name := range changedSettings(c.flags, fs) {
+		if set, ok := liveSettings[name]; ok {
+			set(&applied, &fresh)
+			live = append(live, "-"+name)
+		} else {
+			restart = append(restart, "-"+name)
+		}
+	}
+	// restart-only changes are reported once rather than on every reload
+	c.flags = fs
+	if len(restart) > 0 {
+		log.Println("Warning: restart to apply config changes to", strings.Join(restart, ", "))
+	}
+	if len(live) > 0 {
+		c.apply(applied)
+		c.args = applied
+		log.Println("Applied config changes to", strings.Join(live, ", "))
+	}
+	return nil
+}
+
+// watch calls reload whenever the file at path changes, going by its
+// mtime and size, looking every interval. It never returns.
+func (c *configReloader) watch(path string, interval time.Duration) {
+	last, _ := os.Stat(path)
+	for range time.Tick(interval) {
+		info, err := os.Stat(path)
+		if err != nil {
+			// mid-save, perhaps; look again next time
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+		if err := c.reload(); err != nil {
+			log.Println("Failed to reload config:", err)
+		}
+	}
+}
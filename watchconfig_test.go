@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigReloaderAppliesLiveSettings(t *testing.T) {
+	before := writeTree(t, "index.html")
+	after := writeTree(t, "index.html", "new.txt")
+	path := writeConfig(t, `{"rootdir": "`+before+`", "port": 8781}`)
+	arguments := []string{"-config", path}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	args, err := parseArgsFrom(fs, arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := newSwapHandler(spaHandler{staticPath: args.RootDir, indexPath: "index.html"})
+	var applied []CmdLineArgs
+	reloader := &configReloader{
+		arguments: arguments,
+		flags:     fs,
+		args:      args,
+		apply: func(args CmdLineArgs) {
+			applied = append(applied, args)
+			live.set(spaHandler{staticPath: args.RootDir, indexPath: "index.html"})
+		},
+	}
+	get := func() int {
+		w := httptest.NewRecorder()
+		live.ServeHTTP(w, httptest.NewRequest("GET", "/new.txt", nil))
+		if w.Body.String() == "new.txt" {
+			return http.StatusOK
+		}
+		return http.StatusNotFound
+	}
+	if get() != http.StatusNotFound {
+		t.Fatal("new.txt served before the reload")
+	}
+
+	buf := captureLog(t)
+	config := `{"rootdir": "` + after + `", "port": 8782}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 1 {
+		t.Fatalf("applied %d times, want once", len(applied))
+	}
+	if applied[0].RootDir != after {
+		t.Errorf("rootdir = %q, want %q", applied[0].RootDir, after)
+	}
+	if applied[0].Port != 8781 {
+		t.Errorf("port = %d, want 8781 kept until a restart", applied[0].Port)
+	}
+	if !strings.Contains(buf.String(), "restart to apply config changes to -port") {
+		t.Errorf("logged %q, want a restart warning for -port", buf.String())
+	}
+	if get() != http.StatusOK {
+		t.Error("new.txt not served after the reload")
+	}
+
+	// nothing changed, nothing applied
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("applied %d times, want once", len(applied))
+	}
+}
+
+func TestConfigReloaderKeepsSettingsOnError(t *testing.T) {
+	path := writeConfig(t, `{"rootdir": "dist"}`)
+	arguments := []string{"-config", path}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	args, err := parseArgsFrom(fs, arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := &configReloader{
+		arguments: arguments,
+		flags:     fs,
+		args:      args,
+		apply:     func(CmdLineArgs) { t.Error("applied a broken config") },
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"rootdir": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(); err == nil {
+		t.Error("expected an error for a broken config")
+	}
+}
+
+func TestLiveSettingsAreFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if _, err := parseArgsFrom(fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name := range liveSettings {
+		if fs.Lookup(name) == nil {
+			t.Errorf("live setting %q is not a flag", name)
+		}
+	}
+}
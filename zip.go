@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// zipHandler streams a zip archive of a directory within the served
+// root, named by the path query parameter. The archive is written as it
+// is built, so it is never held in memory as a whole. Only files the spa
+// handler would serve to the same client are included, and never dotfiles
+// or anything under a dot directory.
+type zipHandler struct {
+	spa spaHandler
+	// bufSize is the size of the buffer file contents are copied with
+	bufSize int
+}
+
+func (h zipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	root := h.spa.root()
+	dir, ok := resolveWithin(root, r.URL.Query().Get("path"))
+	if !ok {
+		badRequest(w, r, "invalid_path", "invalid path")
+		return
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() || (h.spa.noFollowSymlinks && !resolvesWithin(root, dir)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := filepath.Base(dir)
+	if name == string(filepath.Separator) || name == "." {
+		name = "download"
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+".zip\"")
+
+	buf := make([]byte, h.bufSize)
+	zw := zip.NewWriter(w)
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != dir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// skip directories, symlinks and anything else that isn't a file
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		urlPath, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if h.spa.hidden(r, "/"+filepath.ToSlash(urlPath)) {
+			return nil
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyBuffer(entry, f, buf)
+		return err
+	})
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// the response has already started, so all we can do is log it
+		log.Println("zip download failed:", err)
+	}
+}
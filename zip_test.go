@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree creates the named files, with their names as contents, under
+// a new temporary directory.
+func writeTree(t *testing.T, names ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range names {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func zipNames(t *testing.T, h zipHandler, query string) []string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/download.zip?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestZipHandler(t *testing.T) {
+	root := writeTree(t, "index.html", "docs/a.txt", "docs/sub/b.txt")
+	h := zipHandler{spa: spaHandler{staticPath: root, indexPath: "index.html"}, bufSize: 512}
+
+	got := strings.Join(zipNames(t, h, "path=/docs"), " ")
+	if want := "a.txt sub/b.txt"; got != want {
+		t.Errorf("archive holds %q, want %q", got, want)
+	}
+}
+
+func TestZipHandlerFilters(t *testing.T) {
+	root := writeTree(t,
+		"index.html", "app.js", "app.js.map", "notes.txt",
+		".env", ".git/config", "assets/.hidden.js", "assets/logo.js")
+	_, local, _ := net.ParseCIDR("10.0.0.0/8")
+	h := zipHandler{
+		spa: spaHandler{
+			staticPath: root,
+			indexPath:  "index.html",
+			hideIndex:  true,
+			sourcemaps: ipAllowlist{local},
+			allowExt:   map[string]bool{".html": true, ".js": true, ".map": true},
+		},
+		bufSize: 512,
+	}
+
+	got := strings.Join(zipNames(t, h, "path=/"), " ")
+	if want := "app.js assets/logo.js"; got != want {
+		t.Errorf("archive holds %q, want %q", got, want)
+	}
+}
+
+func TestZipHandlerNotFound(t *testing.T) {
+	root := writeTree(t, "index.html")
+	h := zipHandler{spa: spaHandler{staticPath: root}, bufSize: 512}
+	for _, query := range []string{"path=/missing", "path=/index.html"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/download.zip?"+query, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", query, w.Code)
+		}
+	}
+}
+
+// BenchmarkZipBufferSize builds the same archive with different copy
+// buffer sizes.
+func BenchmarkZipBufferSize(b *testing.B) {
+	root := b.TempDir()
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+	for _, name := range []string{"a.bin", "b.bin", "c.bin", "d.bin"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), body, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, size := range []int{512, 32 << 10, 256 << 10} {
+		h := zipHandler{spa: spaHandler{staticPath: root, indexPath: "index.html"}, bufSize: size}
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			r := httptest.NewRequest("GET", "/download.zip?path=/", nil)
+			b.SetBytes(4 * int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}